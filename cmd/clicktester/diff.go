@@ -0,0 +1,79 @@
+// Package main — команда diff: сравнение двух JSON-отчётов.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"clicktester/internal/report"
+)
+
+// runDiff — команда diff: сравнение двух JSON-отчётов (clicktester diff [флаги] old.json new.json).
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	format := fs.String("format", "html", "output format: html, md or json")
+	output := fs.String("output", "", "output path (default reports/diff.<format>; - for stdout)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: clicktester diff [-format html|md|json] [-output path] old.json new.json\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitSetupError
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return exitSetupError
+	}
+	oldPath, newPath := fs.Arg(0), fs.Arg(1)
+
+	var write func(string, *report.DiffReport) error
+	switch *format {
+	case "html":
+		write = report.WriteDiffHTML
+	case "md", "markdown":
+		*format = "md"
+		write = report.WriteDiffMarkdown
+	case "json":
+		write = report.WriteDiffJSON
+	default:
+		fmt.Fprintf(os.Stderr, "diff: unknown format %q (want html, md or json)\n", *format)
+		return exitSetupError
+	}
+
+	oldData, err := report.ReadJSON(oldPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "diff: %v\n", err)
+		return exitSetupError
+	}
+	newData, err := report.ReadJSON(newPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "diff: %v\n", err)
+		return exitSetupError
+	}
+
+	outPath := *output
+	if outPath == "" {
+		outPath = filepath.Join("reports", "diff."+*format)
+	}
+	if outPath != "-" {
+		if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "mkdir report: %v\n", err)
+			return exitSetupError
+		}
+	}
+	d := report.Diff(oldPath, oldData, newPath, newData)
+	if err := write(outPath, d); err != nil {
+		fmt.Fprintf(os.Stderr, "diff: %v\n", err)
+		return exitSetupError
+	}
+	if outPath != "-" {
+		fmt.Printf("clicktester diff: status changes=%d, added=%d, removed=%d, report=%s\n", d.Changed, d.Added, d.Removed, outPath)
+	}
+	return exitOK
+}
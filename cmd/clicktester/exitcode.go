@@ -0,0 +1,60 @@
+// Package main — коды возврата для CI и политика -fail-on.
+package main
+
+import (
+	"clicktester/internal/report"
+	"clicktester/internal/runner"
+	"clicktester/internal/tests"
+)
+
+// Коды возврата: по ним CI отличает предупреждения от падений, а падения — от проблем окружения.
+const (
+	exitOK         = 0   // все задачи ok
+	exitWarn       = 1   // есть warn, но по политике -fail-on fail сборку не валит
+	exitFail       = 2   // нарушены ожидания или пороги (granules_fail, assertions, expect) либо есть регрессии
+	exitQueryError = 3   // запрос завершился ошибкой
+	exitSetupError = 4   // ошибка конфига, подключения, флагов или записи отчёта
+	exitCancelled  = 130 // прогон прерван Ctrl+C (как принято у shell для SIGINT)
+)
+
+// Политики -fail-on.
+const (
+	failOnFail = "fail"
+	failOnWarn = "warn"
+)
+
+// exitCode выбирает код возврата по самому тяжёлому статусу прогона.
+// Предупреждения всегда дают отдельный код exitWarn; при -fail-on warn они считаются падением (exitFail).
+func exitCode(c report.StatusCounts, failOn string) int {
+	switch {
+	case c.Cancelled > 0:
+		return exitCancelled
+	case c.Errors > 0:
+		return exitQueryError
+	case c.Fail > 0 || c.Regressions > 0:
+		return exitFail
+	case c.Warn > 0 && failOn == failOnWarn:
+		return exitFail
+	case c.Warn > 0:
+		return exitWarn
+	}
+	return exitOK
+}
+
+// comparisonCounts считает статусы -compare: каждый шаблон на table_a и table_b — отдельная задача.
+func comparisonCounts(res *tests.ComparisonResult, meta *report.ReportMeta) report.StatusCounts {
+	r := &tests.RunResult{}
+	for _, p := range res.Pairs {
+		r.Results = append(r.Results, p.A, p.B)
+	}
+	return report.CountStatuses(r, meta)
+}
+
+// stressCounts переводит итог -stress в статусы: запросы с ошибкой БД/сети — Errors, Ctrl+C — Cancelled.
+func stressCounts(res *runner.StressResult, interrupted bool) report.StatusCounts {
+	c := report.StatusCounts{OK: res.Success, Errors: res.Failed}
+	if interrupted {
+		c.Cancelled = 1
+	}
+	return c
+}
@@ -0,0 +1,57 @@
+// Package main — отмена прогона по Ctrl+C с KILL QUERY.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"clicktester/internal/chclient"
+	"clicktester/internal/runner"
+)
+
+// errInterrupted — прогон прерван Ctrl+C (отчёт по выполненной части записан).
+var errInterrupted = errors.New("interrupted")
+
+// interruptible возвращает контекст прогона, отменяемый по Ctrl+C (SIGINT/SIGTERM): выполняющиеся запросы
+// снимаются на сервере через KILL QUERY, оставшиеся задачи помечаются cancelled и отчёт всё равно пишется.
+// Повторный Ctrl+C завершает процесс сразу. stop снимает обработчик сигналов, дожидается KILL QUERY
+// и возвращает его ошибку (запросы могли остаться на сервере — это попадает в отчёт).
+func interruptible(ctx context.Context, client chclient.Client) (runCtx context.Context, stop func() error) {
+	ctx, cancel := context.WithCancel(ctx)
+	ctx, tracker := chclient.WithQueryTracker(ctx)
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	aborted := make(chan struct{})
+	var abortErr error
+	go func() {
+		defer close(aborted)
+		select {
+		case <-sig:
+		case <-done:
+			return
+		}
+		fmt.Fprintln(os.Stderr, "clicktester: interrupted, cancelling queries (Ctrl+C again to exit immediately)")
+		go func() {
+			select {
+			case <-sig:
+				os.Exit(exitCancelled)
+			case <-done:
+			}
+		}()
+		if abortErr = runner.Abort(cancel, tracker, client); abortErr != nil {
+			fmt.Fprintf(os.Stderr, "cancel: %v\n", abortErr)
+		}
+	}()
+	return ctx, func() error {
+		signal.Stop(sig)
+		close(done)
+		cancel()
+		<-aborted
+		return abortErr
+	}
+}
@@ -3,8 +3,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -19,19 +21,45 @@ import (
 )
 
 func main() {
+	// ошибки разбора флагов — код exitSetupError, а не 2 (2 — exitFail)
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(runDiff(os.Args[2:]))
+	}
+
 	cfgPath := flag.String("config", "configs/default.yaml", "path to YAML/JSON config")
 	workers := flag.Int("workers", 0, "override number of workers (0 = use config)")
 	output := flag.String("output", "", "path to output HTML report (overrides config)")
-	format := flag.String("format", "html", "output format: html, json, or both")
+	format := flag.String("format", "html", "output format: html, json, junit, both (html+json) or a comma-separated list, e.g. html,junit")
 	stress := flag.Bool("stress", false, "run stress test (N min, N workers, one query with shifting time to avoid cache)")
 	serve := flag.Bool("serve", false, "start HTTP server and open browser with test list")
 	port := flag.Int("port", 8080, "port for HTTP server (when -serve)")
-	flag.Parse()
+	listen := flag.String("listen", "", "address for HTTP server, e.g. 127.0.0.1:8080 (overrides server.listen and -port)")
+	compare := flag.Bool("compare", false, "A/B mode: run query_templates against comparison.table_a and table_b and write a side-by-side report")
+	baseline := flag.String("baseline", "", "path to a previous report.json; flag regressions against it (non-zero exit code on regression)")
+	failOn := flag.String("fail-on", failOnFail, "exit code policy: fail (warnings exit 1) or warn (warnings fail the build with exit 2)")
+	cacheMode := flag.String("cache-mode", "", "override execution.cache_mode: warm, cold (drop caches before each query) or both")
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(exitOK)
+		}
+		os.Exit(exitSetupError)
+	}
+	if *failOn != failOnFail && *failOn != failOnWarn {
+		fmt.Fprintf(os.Stderr, "fail-on: want %s or %s, got %q\n", failOnFail, failOnWarn, *failOn)
+		os.Exit(exitSetupError)
+	}
+
+	formats, err := parseFormats(*format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "format: %v\n", err)
+		os.Exit(exitSetupError)
+	}
 
 	cfg, err := config.Load(*cfgPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "config: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitSetupError)
 	}
 
 	if *workers > 0 {
@@ -40,39 +68,41 @@ func main() {
 	if *output != "" {
 		cfg.Report.OutputPath = *output
 	}
+	if *cacheMode != "" {
+		if err := config.ValidateCacheMode(*cacheMode); err != nil {
+			fmt.Fprintf(os.Stderr, "config: %v\n", err)
+			os.Exit(exitSetupError)
+		}
+		cfg.Execution.CacheMode = *cacheMode
+	}
 
 	ctx := context.Background()
 
 	if *stress {
-		if cfg.StressTest == nil || cfg.StressTest.QueryName == "" {
-			fmt.Fprintf(os.Stderr, "stress: config must have stress_test.query_name (and duration_minutes, workers)\n")
-			os.Exit(1)
+		if cfg.StressTest == nil || (cfg.StressTest.QueryName == "" && len(cfg.StressTest.Queries) == 0) {
+			fmt.Fprintf(os.Stderr, "stress: config must have stress_test.query_name or stress_test.queries (and duration_minutes, workers)\n")
+			os.Exit(exitSetupError)
 		}
-		baseQuery, err := config.StressQueryByName(cfg, cfg.StressTest.QueryName)
+		if formats["junit"] {
+			fmt.Fprintf(os.Stderr, "stress: junit format is not supported for -stress\n")
+			os.Exit(exitSetupError)
+		}
+		mix, err := stressQueries(cfg, cfg.StressTest.Mix())
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "stress: %v\n", err)
-			os.Exit(1)
-		}
-		opts := chclient.ConnectOptions{
-			Host:           cfg.ClickHouse.Host,
-			Port:           cfg.ClickHouse.Port,
-			Database:       cfg.ClickHouse.Database,
-			User:           cfg.ClickHouse.User,
-			Password:       cfg.ClickHouse.Password,
-			Table:          cfg.ClickHouse.TableName,
-			Secure:         cfg.ClickHouse.Secure,
-			TLSSkipVerify:  cfg.ClickHouse.TLSSkipVerify,
-			TLSCAFile:      cfg.ClickHouse.TLSCAFile,
-			TLSPfxFile:     cfg.ClickHouse.TLSPfxFile,
-			TLSPfxPassword: cfg.ClickHouse.TLSPfxPassword,
-		}
-		client, err := chclient.New(ctx, opts)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "clickhouse: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitSetupError)
 		}
-		defer func() { _ = client.Close() }()
-		duration := time.Duration(cfg.StressTest.DurationMinutes) * time.Minute
+		baseQuery, queryDesc := mix[0].Query, cfg.StressTest.QueryName
+		if len(cfg.StressTest.Queries) > 0 {
+			var parts []string
+			for _, q := range mix {
+				parts = append(parts, fmt.Sprintf("%s:%g", q.Name, q.Weight))
+			}
+			queryDesc = "mix(" + strings.Join(parts, ",") + ")"
+		} else {
+			mix = nil
+		}
+		duration := cfg.StressTest.Duration()
 		workers := cfg.StressTest.Workers
 		if workers < 1 {
 			workers = cfg.Execution.Workers
@@ -81,95 +111,169 @@ func main() {
 			workers = 1
 		}
 		queryTimeout := time.Duration(cfg.Execution.QueryTimeoutSec) * time.Second
-		stressCtx, cancel := context.WithTimeout(ctx, duration)
+		opts := runner.StressOptions{
+			Workers:      workers,
+			TargetQPS:    cfg.StressTest.TargetQPS,
+			MaxInFlight:  cfg.StressTest.MaxInFlight,
+			QueryTimeout: queryTimeout,
+			Stages:       stressStages(cfg.StressTest.Stages),
+			Queries:      mix,
+			ServerStats:  true,
+		}
+		connOpts := connectOptions(cfg)
+		connOpts.MaxOpenConns = opts.Concurrency()
+		client, err := chclient.New(ctx, connOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "clickhouse: %v\n", err)
+			os.Exit(exitSetupError)
+		}
+		defer func() { _ = client.Close() }()
+		runCtx, stop := interruptible(ctx, client)
+		stressCtx, cancel := context.WithTimeout(runCtx, duration)
 		defer cancel()
-		fmt.Printf("clicktester stress: duration=%v, workers=%d, query=%s\n", duration, workers, cfg.StressTest.QueryName)
-		res := runner.RunStress(stressCtx, baseQuery, workers, queryTimeout, client)
-		fmt.Printf("stress result: total=%d success=%d failed=%d cancelled=%d duration=%.1fs QPS=%.1f latency_p50=%.1fms p95=%.1fms p99=%.1fms\n",
-			res.Total, res.Success, res.Failed, res.Cancelled, res.DurationSec, res.QPS, res.LatencyP50Ms, res.LatencyP95Ms, res.LatencyP99Ms)
+		if len(opts.Stages) > 0 {
+			fmt.Printf("clicktester stress: duration=%v, %d stages, query=%s\n", duration, len(opts.Stages), queryDesc)
+		} else if opts.TargetQPS > 0 {
+			fmt.Printf("clicktester stress: duration=%v, open model target_qps=%.1f max_in_flight=%d, query=%s\n", duration, opts.TargetQPS, opts.MaxInFlight, queryDesc)
+		} else {
+			fmt.Printf("clicktester stress: duration=%v, workers=%d, query=%s\n", duration, workers, queryDesc)
+		}
+		res := runner.RunStressWithProgress(stressCtx, baseQuery, opts, client, nil)
+		interrupted := runCtx.Err() != nil
+		var warnings []string
+		if err := stop(); err != nil {
+			warnings = append(warnings, runner.AbortWarning(err))
+		}
+		fmt.Printf("stress result: total=%d success=%d failed=%d cancelled=%d duration=%.1fs QPS=%.1f latency_p50=%.1fms p95=%.1fms p99=%.1fms max=%.1fms\n",
+			res.Total, res.Success, res.Failed, res.Cancelled, res.DurationSec, res.QPS, res.LatencyP50Ms, res.LatencyP95Ms, res.LatencyP99Ms, res.LatencyMaxMs)
+		if res.Mode == runner.StressModeOpen {
+			fmt.Printf("open model: target_qps=%.1f dropped=%d late=%d (latency measured from intended start)\n", res.TargetQPS, res.Dropped, res.Late)
+		}
+		for _, t := range res.Templates {
+			fmt.Printf("  template %s (weight %g): total=%d failed=%d QPS=%.1f p50=%.1fms p95=%.1fms p99=%.1fms\n",
+				t.Name, t.Weight, t.Total, t.Failed, t.QPS, t.LatencyP50Ms, t.LatencyP95Ms, t.LatencyP99Ms)
+		}
+		for _, st := range res.Stages {
+			target := fmt.Sprintf("workers=%d", st.Workers)
+			if res.Mode == runner.StressModeOpen {
+				target = fmt.Sprintf("target_qps=%.1f", st.TargetQPS)
+			}
+			if st.Ramp {
+				target += " (ramp)"
+			}
+			fmt.Printf("  stage %d at %.0fs: %s total=%d failed=%d dropped=%d QPS=%.1f p50=%.1fms p95=%.1fms p99=%.1fms\n",
+				st.Stage, st.StartSec, target, st.Total, st.Failed, st.Dropped, st.QPS, st.LatencyP50Ms, st.LatencyP95Ms, st.LatencyP99Ms)
+		}
 		if len(res.ErrorSamples) > 0 {
 			fmt.Fprintf(os.Stderr, "error samples:\n")
 			for _, s := range res.ErrorSamples {
 				fmt.Fprintf(os.Stderr, "  %s\n", s)
 			}
 		}
-		return
+		if srv := res.Server; srv != nil && srv.Error != "" {
+			fmt.Fprintf(os.Stderr, "server metrics from query_log unavailable: %s\n", srv.Error)
+		} else if srv != nil {
+			fmt.Printf("server (query_log): queries=%d exceptions=%d duration avg=%.1fms p95=%.1fms p99=%.1fms read_rows=%d memory_max=%.1fMB\n",
+				srv.Queries, srv.Exceptions, srv.DurationAvgMs, srv.DurationP95Ms, srv.DurationP99Ms, srv.ReadRows, float64(srv.MemoryMax)/(1024*1024))
+		}
+		stressCfg := report.NewStressConfig(cfg.StressTest.QueryName, opts, duration)
+		reportPaths, err := writeStressReports(cfg, stressReportPath(cfg, *output), formats, stressCfg, res, warnings)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "stress: %v\n", err)
+			os.Exit(exitSetupError)
+		}
+		fmt.Printf("clicktester stress: report=%s\n", strings.Join(reportPaths, ", "))
+		os.Exit(exitCode(stressCounts(res, interrupted), *failOn))
+	}
+
+	if *compare {
+		counts, err := runCompare(ctx, cfg, formats)
+		if err != nil {
+			if errors.Is(err, errInterrupted) {
+				os.Exit(exitCancelled)
+			}
+			fmt.Fprintf(os.Stderr, "compare: %v\n", err)
+			os.Exit(exitSetupError)
+		}
+		os.Exit(exitCode(counts, *failOn))
 	}
 
 	if *serve {
 		tasks, err := config.BuildTasks(cfg)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "build tasks: %v\n", err)
-			os.Exit(1)
-		}
-		opts := chclient.ConnectOptions{
-			Host:           cfg.ClickHouse.Host,
-			Port:           cfg.ClickHouse.Port,
-			Database:       cfg.ClickHouse.Database,
-			User:           cfg.ClickHouse.User,
-			Password:       cfg.ClickHouse.Password,
-			Table:          cfg.ClickHouse.TableName,
-			Secure:         cfg.ClickHouse.Secure,
-			TLSSkipVerify:  cfg.ClickHouse.TLSSkipVerify,
-			TLSCAFile:      cfg.ClickHouse.TLSCAFile,
-			TLSPfxFile:     cfg.ClickHouse.TLSPfxFile,
-			TLSPfxPassword: cfg.ClickHouse.TLSPfxPassword,
-		}
-		client, err := chclient.New(ctx, opts)
+			os.Exit(exitSetupError)
+		}
+		client, err := chclient.New(ctx, connectOptions(cfg))
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "clickhouse: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitSetupError)
 		}
 		defer func() { _ = client.Close() }()
 		if *port <= 0 {
 			*port = 8080
 		}
-		baseURL := "http://127.0.0.1:" + strconv.Itoa(*port)
+		addr := *listen
+		if addr == "" {
+			addr = cfg.Server.Listen
+		}
+		if addr == "" {
+			addr = ":" + strconv.Itoa(*port)
+		}
+		baseURL, err := browserURL(addr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "listen: %v\n", err)
+			os.Exit(exitSetupError)
+		}
 		fmt.Printf("clicktester: server at %s (Ctrl+C to stop)\n", baseURL)
-		if err := server.Run(ctx, cfg, tasks, client, *port, baseURL); err != nil {
+		if err := server.Run(ctx, cfg, tasks, client, connectOptions(cfg), addr, baseURL); err != nil {
 			fmt.Fprintf(os.Stderr, "server: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitSetupError)
 		}
 		return
 	}
 
-	opts := chclient.ConnectOptions{
-		Host:           cfg.ClickHouse.Host,
-		Port:           cfg.ClickHouse.Port,
-		Database:       cfg.ClickHouse.Database,
-		User:           cfg.ClickHouse.User,
-		Password:       cfg.ClickHouse.Password,
-		Table:          cfg.ClickHouse.TableName,
-		Secure:         cfg.ClickHouse.Secure,
-		TLSSkipVerify:  cfg.ClickHouse.TLSSkipVerify,
-		TLSCAFile:      cfg.ClickHouse.TLSCAFile,
-		TLSPfxFile:     cfg.ClickHouse.TLSPfxFile,
-		TLSPfxPassword: cfg.ClickHouse.TLSPfxPassword,
-	}
-	client, err := chclient.New(ctx, opts)
+	client, err := chclient.New(ctx, connectOptions(cfg))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "clickhouse: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitSetupError)
 	}
 	defer func() { _ = client.Close() }()
 
 	tasks, err := config.BuildTasks(cfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "build tasks: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitSetupError)
 	}
 
 	queryTimeout := time.Duration(cfg.Execution.QueryTimeoutSec) * time.Second
-	result, err := runner.Run(ctx, tasks, cfg.Execution.Workers, client, queryTimeout)
+	runCtx, stop := interruptible(ctx, client)
+	result, err := runner.Run(runCtx, tasks, cfg.Execution.Workers, client, queryTimeout)
+	abortErr := stop()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "runner: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitSetupError)
+	}
+
+	regressed := 0
+	if *baseline != "" {
+		base, err := report.ReadJSON(*baseline)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "baseline: %v\n", err)
+			os.Exit(exitSetupError)
+		}
+		th, err := regressionThresholds(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "config: %v\n", err)
+			os.Exit(exitSetupError)
+		}
+		regressed = report.ApplyBaseline(result, base, th)
 	}
 
 	outPath := cfg.Report.OutputPath
 	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
 		fmt.Fprintf(os.Stderr, "mkdir report: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitSetupError)
 	}
 	reportMeta := &report.ReportMeta{
 		GeneratedAt: time.Now().Format("2006-01-02 15:04:05"),
@@ -180,40 +284,269 @@ func main() {
 		GranulesWarn: cfg.Report.Thresholds.GranulesWarn,
 		GranulesFail: cfg.Report.Thresholds.GranulesFail,
 		ReadRowsWarn: cfg.Report.Thresholds.ReadRowsWarn,
+		Baseline:     *baseline,
 	}
-	writeHTML := *format == "html" || *format == "both"
-	writeJSON := *format == "json" || *format == "both"
-	jsonPath := outPath
-	if strings.HasSuffix(strings.ToLower(outPath), ".html") {
-		jsonPath = outPath[:len(outPath)-5] + ".json"
-	} else {
-		jsonPath = outPath + ".json"
+	if abortErr != nil {
+		reportMeta.Warnings = append(reportMeta.Warnings, runner.AbortWarning(abortErr))
 	}
-	if writeHTML {
+	var reportPaths []string
+	if formats["html"] {
 		if err := report.WriteHTML(outPath, result, reportMeta); err != nil {
 			fmt.Fprintf(os.Stderr, "report: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitSetupError)
 		}
+		reportPaths = append(reportPaths, outPath)
 	}
-	if writeJSON {
+	if formats["json"] {
+		jsonPath := jsonPathFor(outPath)
 		if err := report.WriteJSON(jsonPath, result, reportMeta); err != nil {
 			fmt.Fprintf(os.Stderr, "report json: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitSetupError)
 		}
+		reportPaths = append(reportPaths, jsonPath)
 	}
-	reportPaths := outPath
-	if writeHTML && writeJSON {
-		reportPaths = outPath + ", " + jsonPath
-	} else if writeJSON {
-		reportPaths = jsonPath
+	if formats["junit"] {
+		junitPath := reportPathWithExt(outPath, ".xml")
+		if err := report.WriteJUnit(junitPath, result, reportMeta); err != nil {
+			fmt.Fprintf(os.Stderr, "report junit: %v\n", err)
+			os.Exit(exitSetupError)
+		}
+		reportPaths = append(reportPaths, junitPath)
 	}
-	fmt.Printf("clicktester: tasks=%d, passed=%d, failed=%d, report=%s\n",
-		result.Total, result.Passed, result.Failed, reportPaths)
+	fmt.Printf("clicktester: tasks=%d, passed=%d, failed=%d, cancelled=%d, report=%s\n",
+		result.Total, result.Passed, result.Failed, result.Cancelled, strings.Join(reportPaths, ", "))
 	if result.Failed > 0 {
 		for _, r := range result.Results {
-			if !r.Pass {
+			if !r.Pass && !r.Cancelled {
 				fmt.Fprintf(os.Stderr, "  FAIL %s (%s): %s\n", r.Name, r.Type, r.Error)
 			}
 		}
 	}
+	if regressed > 0 {
+		fmt.Fprintf(os.Stderr, "regressions vs %s: %d task(s)\n", *baseline, regressed)
+		for _, r := range result.Results {
+			for _, reg := range r.Regressions {
+				fmt.Fprintf(os.Stderr, "  REGRESSION %s: %s\n", r.Name, report.FormatRegression(reg))
+			}
+		}
+	}
+
+	counts := report.CountStatuses(result, reportMeta)
+	if counts.Warn > 0 {
+		for _, r := range result.Results {
+			if r.Pass && report.Status(r, reportMeta) == report.StatusWarn {
+				fmt.Fprintf(os.Stderr, "  WARN %s: granules=%d read_rows=%d\n", r.Name, r.Granules, r.ReadRows)
+			}
+		}
+	}
+	os.Exit(exitCode(counts, *failOn))
+}
+
+// jsonPathFor возвращает путь JSON-отчёта рядом с HTML: report.html → report.json.
+func jsonPathFor(outPath string) string {
+	return reportPathWithExt(outPath, ".json")
+}
+
+// reportPathWithExt заменяет расширение .html у пути отчёта на ext (без .html — добавляет ext).
+func reportPathWithExt(outPath, ext string) string {
+	if strings.HasSuffix(strings.ToLower(outPath), ".html") {
+		return outPath[:len(outPath)-5] + ext
+	}
+	return outPath + ext
+}
+
+// parseFormats разбирает -format: html, json, junit, both (html+json) или список через запятую.
+func parseFormats(s string) (map[string]bool, error) {
+	out := make(map[string]bool)
+	for _, f := range strings.Split(s, ",") {
+		switch f = strings.TrimSpace(f); f {
+		case "html", "json", "junit":
+			out[f] = true
+		case "both":
+			out["html"] = true
+			out["json"] = true
+		default:
+			return nil, fmt.Errorf("unknown format %q (want html, json, junit or both)", f)
+		}
+	}
+	return out, nil
+}
+
+// runCompare выполняет A/B-сравнение таблиц из секции comparison, пишет отчёт в report.output_path
+// и возвращает статусы задач на обеих таблицах для кода возврата.
+func runCompare(ctx context.Context, cfg *config.Config, formats map[string]bool) (report.StatusCounts, error) {
+	if formats["junit"] {
+		return report.StatusCounts{}, fmt.Errorf("junit format is not supported for -compare")
+	}
+	a, b, err := config.BuildComparisonTasks(cfg)
+	if err != nil {
+		return report.StatusCounts{}, err
+	}
+	client, err := chclient.New(ctx, connectOptions(cfg))
+	if err != nil {
+		return report.StatusCounts{}, fmt.Errorf("clickhouse: %w", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	tableA := config.ComparisonTable(cfg, cfg.Comparison.TableA)
+	tableB := config.ComparisonTable(cfg, cfg.Comparison.TableB)
+	queryTimeout := time.Duration(cfg.Execution.QueryTimeoutSec) * time.Second
+	fmt.Printf("clicktester compare: %s vs %s, templates=%d, workers=%d\n", tableA, tableB, len(a), cfg.Execution.Workers)
+	runCtx, stop := interruptible(ctx, client)
+	res := runner.RunComparison(runCtx, a, b, tableA, tableB, cfg.Execution.Workers, client, queryTimeout, cfg.Comparison.TieThresholdPct)
+	interrupted := runCtx.Err() != nil
+	abortErr := stop()
+
+	outPath := cfg.Report.OutputPath
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return report.StatusCounts{}, fmt.Errorf("mkdir report: %w", err)
+	}
+	meta := &report.ReportMeta{
+		GeneratedAt:  time.Now().Format("2006-01-02 15:04:05"),
+		Host:         cfg.ClickHouse.Host,
+		Database:     cfg.ClickHouse.Database,
+		Workers:      cfg.Execution.Workers,
+		GranulesWarn: cfg.Report.Thresholds.GranulesWarn,
+		GranulesFail: cfg.Report.Thresholds.GranulesFail,
+		ReadRowsWarn: cfg.Report.Thresholds.ReadRowsWarn,
+	}
+	if abortErr != nil {
+		meta.Warnings = append(meta.Warnings, runner.AbortWarning(abortErr))
+	}
+	var reportPaths []string
+	if formats["html"] {
+		if err := report.WriteComparisonHTML(outPath, res, meta); err != nil {
+			return report.StatusCounts{}, fmt.Errorf("report: %w", err)
+		}
+		reportPaths = append(reportPaths, outPath)
+	}
+	if formats["json"] {
+		jsonPath := jsonPathFor(outPath)
+		if err := report.WriteComparisonJSON(jsonPath, res, meta); err != nil {
+			return report.StatusCounts{}, fmt.Errorf("report json: %w", err)
+		}
+		reportPaths = append(reportPaths, jsonPath)
+	}
+	fmt.Printf("clicktester compare: %s wins=%d, %s wins=%d, ties=%d, report=%s\n",
+		tableA, res.WinsA, tableB, res.WinsB, res.Ties, strings.Join(reportPaths, ", "))
+	counts := comparisonCounts(res, meta)
+	if interrupted {
+		return counts, errInterrupted
+	}
+	return counts, nil
+}
+
+// regressionThresholds переводит report.regression из конфига в пороги сравнения с baseline.
+func regressionThresholds(cfg *config.Config) (report.RegressionThresholds, error) {
+	rc := cfg.Report.Regression
+	th := report.RegressionThresholds{
+		Default: report.Threshold{Percent: rc.Percent, Absolute: rc.Absolute},
+		Metrics: make(map[string]report.Threshold, len(rc.Metrics)),
+	}
+	for name, m := range rc.Metrics {
+		if err := report.ValidateRegressionMetric(name); err != nil {
+			return th, fmt.Errorf("report.regression.metrics: %w", err)
+		}
+		th.Metrics[name] = report.Threshold{Percent: m.Percent, Absolute: m.Absolute}
+	}
+	return th, nil
+}
+
+// stressReportPath — путь HTML-отчёта стресс-теста: -output, stress_test.output_path или report.output_path
+// с суффиксом -stress (reports/report-stress.html), чтобы не перезаписать отчёт обычного прогона.
+func stressReportPath(cfg *config.Config, output string) string {
+	if output != "" {
+		return output
+	}
+	if cfg.StressTest.OutputPath != "" {
+		return cfg.StressTest.OutputPath
+	}
+	return reportPathWithExt(cfg.Report.OutputPath, "-stress.html")
+}
+
+// writeStressReports пишет отчёт стресс-теста в форматах из -format и возвращает пути файлов.
+func writeStressReports(cfg *config.Config, outPath string, formats map[string]bool, stressCfg report.StressConfig, res *runner.StressResult, warnings []string) ([]string, error) {
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return nil, fmt.Errorf("mkdir report: %w", err)
+	}
+	meta := &report.ReportMeta{
+		GeneratedAt: time.Now().Format("2006-01-02 15:04:05"),
+		Host:        cfg.ClickHouse.Host,
+		Database:    cfg.ClickHouse.Database,
+		Table:       cfg.ClickHouse.TableName,
+		Workers:     stressCfg.Workers,
+		Warnings:    warnings,
+	}
+	var reportPaths []string
+	if formats["html"] {
+		if err := report.WriteStressHTML(outPath, stressCfg, res, meta); err != nil {
+			return nil, fmt.Errorf("report: %w", err)
+		}
+		reportPaths = append(reportPaths, outPath)
+	}
+	if formats["json"] {
+		jsonPath := jsonPathFor(outPath)
+		if err := report.WriteStressJSON(jsonPath, stressCfg, res, meta); err != nil {
+			return nil, fmt.Errorf("report json: %w", err)
+		}
+		reportPaths = append(reportPaths, jsonPath)
+	}
+	return reportPaths, nil
+}
+
+// stressQueries находит запросы шаблонов смеси в query_templates.
+func stressQueries(cfg *config.Config, mix []config.StressQuery) ([]runner.StressQuery, error) {
+	out := make([]runner.StressQuery, 0, len(mix))
+	for _, q := range mix {
+		query, err := config.StressQueryByName(cfg, q.Name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, runner.StressQuery{Name: q.Name, Query: query, Weight: q.Weight})
+	}
+	return out, nil
+}
+
+// stressStages переводит профиль stress_test.stages в ступени раннера.
+func stressStages(stages []config.StressStage) []runner.StressStage {
+	var out []runner.StressStage
+	for _, st := range stages {
+		out = append(out, runner.StressStage{
+			Duration:  time.Duration(st.DurationSec) * time.Second,
+			Workers:   st.Workers,
+			TargetQPS: st.TargetQPS,
+			Ramp:      st.Ramp,
+		})
+	}
+	return out
+}
+
+// browserURL — адрес для открытия браузера по адресу сервера: пустой хост и 0.0.0.0/:: заменяются на 127.0.0.1.
+func browserURL(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port), nil
+}
+
+// connectOptions собирает параметры подключения к ClickHouse из конфига.
+func connectOptions(cfg *config.Config) chclient.ConnectOptions {
+	return chclient.ConnectOptions{
+		Host:           cfg.ClickHouse.Host,
+		Port:           cfg.ClickHouse.Port,
+		Database:       cfg.ClickHouse.Database,
+		User:           cfg.ClickHouse.User,
+		Password:       cfg.ClickHouse.Password,
+		Table:          cfg.ClickHouse.TableName,
+		Secure:         cfg.ClickHouse.Secure,
+		TLSSkipVerify:  cfg.ClickHouse.TLSSkipVerify,
+		TLSCAFile:      cfg.ClickHouse.TLSCAFile,
+		TLSPfxFile:     cfg.ClickHouse.TLSPfxFile,
+		TLSPfxPassword: cfg.ClickHouse.TLSPfxPassword,
+		ProfileEvents:  cfg.Execution.ProfileEvents,
+	}
 }
@@ -0,0 +1,28 @@
+// Package chclient — сброс серверных кэшей перед холодным замером запроса.
+package chclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// cacheDropStatements — кэши, влияющие на время чтения таблицы: засечки, несжатые блоки, кэш результатов запросов.
+var cacheDropStatements = []string{
+	"SYSTEM DROP MARK CACHE",
+	"SYSTEM DROP UNCOMPRESSED CACHE",
+	"SYSTEM DROP QUERY CACHE",
+}
+
+// DropCaches сбрасывает кэши сервера. Выполняются все команды; ошибки (нет прав SYSTEM DROP CACHE,
+// нет query cache в старых версиях) объединяются в одну — по строке на команду.
+// Page cache ОС и кэши на других репликах кластера не сбрасываются.
+func (c *nativeClient) DropCaches(ctx context.Context) error {
+	var errs []error
+	for _, stmt := range cacheDropStatements {
+		if err := c.conn.Exec(ctx, stmt); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", stmt, err))
+		}
+	}
+	return errors.Join(errs...)
+}
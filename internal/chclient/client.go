@@ -11,9 +11,12 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
@@ -24,8 +27,14 @@ import (
 // Client интерфейс для выполнения запросов к ClickHouse.
 type Client interface {
 	Ping(ctx context.Context) error
-	Query(ctx context.Context, query string) (rows int, readRows, readBytes uint64, stats *QueryStats, err error)
-	Explain(ctx context.Context, query string) (explainText string, err error)
+	Query(ctx context.Context, query string, opts QueryOptions) (rows int, readRows, readBytes uint64, stats *QueryStats, err error)
+	QueryTable(ctx context.Context, query string, maxRows int) (*ResultTable, error)
+	Explain(ctx context.Context, query string) (plan *ExplainPlan, err error)
+	DescribeTable(ctx context.Context, database, table string) (*TableSchema, error)
+	FormatQuery(ctx context.Context, query string) (string, error)
+	DropCaches(ctx context.Context) error
+	KillQueries(ctx context.Context, queryIDs []string) error
+	QueryLogSummary(ctx context.Context, queryIDPrefix string, since time.Time) (*QueryLogSummary, error)
 	Close() error
 }
 
@@ -37,11 +46,30 @@ type ConnectOptions struct {
 	User           string
 	Password       string
 	Table          string // для запроса system.parts по партициям из query_log (опционально)
+	ProfileEvents  []string // имена ProfileEvents для сбора (SelectedMarks, MarkCacheHits, ...)
 	Secure         bool
 	TLSSkipVerify  *bool
 	TLSCAFile      string
 	TLSPfxFile     string
 	TLSPfxPassword string
+	// MaxOpenConns — размер пула соединений (0 — по умолчанию: 2, по HTTP 1). Для стресс-теста — не меньше
+	// числа одновременных запросов, иначе лишние ждут соединение и сервер получает меньшую нагрузку.
+	// По HTTP при пуле больше одного соединения session_id не задаётся: одна сессия не выполняет запросы параллельно.
+	MaxOpenConns int
+}
+
+// QueryOptions — опции выполнения одного запроса.
+type QueryOptions struct {
+	// CollectStats — после запроса дочитать метрики из system.query_log по query_id (память, партиции).
+	// Требует SYSTEM FLUSH LOGS, поэтому в стресс-тесте не используется.
+	CollectStats bool
+	// DisableQueryCache — выполнить с use_query_cache = 0 (холодный/тёплый замер без кэша результатов).
+	DisableQueryCache bool
+	// SkipQueryLog — не дочитывать read_rows/read_bytes из query_log по HTTP, если Progress их не прислал
+	// (стресс-тест: SYSTEM FLUSH LOGS на каждый запрос исказил бы нагрузку).
+	SkipQueryLog bool
+	// QueryIDPrefix — префикс query_id вместо "ct-" (чтобы найти группу запросов в query_log, см. QueryLogSummary).
+	QueryIDPrefix string
 }
 
 // PartitionInfo — сведения о партиции из system.parts (partition, rows, bytes).
@@ -54,19 +82,50 @@ type PartitionInfo struct {
 // QueryStats — метрики из query_log (и system.parts по партициям запроса).
 type QueryStats struct {
 	QueryID          string         // ID запроса для поиска в system.query_log
+	Elapsed          time.Duration  // от отправки запроса до конца потока строк (без дочитывания query_log)
+	FromQueryLog     bool           // метрики дочитаны из system.query_log (иначе Projections неизвестны)
 	ReadRows         uint64
 	ReadBytes        uint64
 	MemoryUsage      uint64
+	QueryDurationMs  uint64            // query_duration_ms (серверное время выполнения)
+	ProfileEvents    map[string]uint64 // выбранные ProfileEvents (из query_log; при native без query_log — из потока ProfileEvents)
+	Projections      []string          // имена проекций, использованных запросом (query_log.projections)
 	Partitions       []string       // partition ID из query_log
 	PartitionDetails []PartitionInfo // строки/байты по каждой партиции из system.parts
 }
 
+// ResultTable — табличный результат запроса: имена и типы колонок, строки в текстовом виде.
+type ResultTable struct {
+	Columns   []string
+	Types     []string
+	Rows      [][]string // не больше maxRows строк
+	TotalRows int        // всего строк в результате
+}
+
 // nativeClient — реализация Client через clickhouse-go/v2 (native или HTTP/HTTPS).
 type nativeClient struct {
 	conn    driver.Conn
 	useHTTP bool
+	// killConn — соединение без session_id для KILL QUERY по HTTP: в сессии основного пула KILL ждал бы
+	// окончания снимаемого запроса и падал с SESSION_IS_LOCKED. Для native — nil (KILL идёт через conn).
+	killConn driver.Conn
 	db      string
 	table   string // для запроса system.parts по партициям
+
+	profileEvents []string // имена ProfileEvents для сбора
+
+	// started и inFlight — начатые и выполняющиеся запросы клиента: по ним видно, мог ли чужой запрос
+	// оказаться «последним запросом пользователя» в query_log (см. queryLogStats).
+	started  atomic.Uint64
+	inFlight atomic.Int32
+}
+
+// begin отмечает начало запроса: seq — его номер, alone — других запросов клиента в этот момент нет.
+// Возвращённую функцию нужно вызвать по завершении запроса.
+func (c *nativeClient) begin() (seq uint64, alone bool, done func()) {
+	seq = c.started.Add(1)
+	alone = c.inFlight.Add(1) == 1
+	return seq, alone, func() { c.inFlight.Add(-1) }
 }
 
 // Порты HTTP/HTTPS интерфейса ClickHouse (в отличие от native 9000/9440).
@@ -88,6 +147,10 @@ func New(ctx context.Context, opt ConnectOptions) (Client, error) {
 	if useHTTP {
 		maxOpen = 1 // один контур: основной запрос и lookup в query_log на одной ноде (query_log локальный)
 	}
+	maxIdle := 1
+	if opt.MaxOpenConns > maxOpen {
+		maxOpen, maxIdle = opt.MaxOpenConns, opt.MaxOpenConns
+	}
 	opts := &clickhouse.Options{
 		Addr: []string{addr},
 		Auth: clickhouse.Auth{
@@ -97,12 +160,14 @@ func New(ctx context.Context, opt ConnectOptions) (Client, error) {
 		},
 		DialTimeout: 10 * time.Second,
 		MaxOpenConns: maxOpen,
-		MaxIdleConns: 1,
+		MaxIdleConns: maxIdle,
 	}
 
 	if useHTTP {
 		opts.Protocol = clickhouse.HTTP
-		opts.Settings = clickhouse.Settings{"session_id": "ct-" + hex.EncodeToString(mustRand(8))}
+		if maxOpen == 1 {
+			opts.Settings = clickhouse.Settings{"session_id": "ct-" + hex.EncodeToString(mustRand(8))}
+		}
 	}
 
 	if opt.Secure || opt.Port == PortHTTPS {
@@ -123,7 +188,17 @@ func New(ctx context.Context, opt ConnectOptions) (Client, error) {
 		return nil, fmt.Errorf("clickhouse ping: %w", err)
 	}
 
-	return &nativeClient{conn: conn, useHTTP: useHTTP, db: opt.Database, table: opt.Table}, nil
+	c := &nativeClient{conn: conn, useHTTP: useHTTP, db: opt.Database, table: opt.Table, profileEvents: opt.ProfileEvents}
+	if useHTTP {
+		killOpts := *opts
+		killOpts.Settings = nil
+		killOpts.MaxOpenConns = 1
+		if c.killConn, err = clickhouse.Open(&killOpts); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("clickhouse open: %w", err)
+		}
+	}
+	return c, nil
 }
 
 // buildTLSConfig собирает tls.Config: CA для проверки сервера, опционально клиентский сертификат из PFX/P12.
@@ -173,23 +248,60 @@ func (c *nativeClient) Ping(ctx context.Context) error {
 }
 
 // Query выполняет запрос и возвращает число строк результата, read_rows и read_bytes.
-// При native — из Progress; при HTTP/HTTPS — по query_id из system.query_log.
+// read_rows/read_bytes берутся из Progress; при native дополнительно собираются ProfileEvents (пиковая память).
+// При opts.CollectStats метрики дочитываются из system.query_log по query_id — одинаково для native и HTTP/HTTPS,
+// чтобы в отчёте были заполнены одни и те же колонки (memory_usage, partitions).
 // Для HTTP передаём свой query_id в URL (?query_id=...) через WithQueryID; драйвер добавляет его в запрос.
-func (c *nativeClient) Query(ctx context.Context, query string) (rows int, readRows, readBytes uint64, stats *QueryStats, err error) {
+func (c *nativeClient) Query(ctx context.Context, query string, opts QueryOptions) (rows int, readRows, readBytes uint64, stats *QueryStats, err error) {
 	queryID := generateQueryID()
+	if opts.QueryIDPrefix != "" {
+		queryID = opts.QueryIDPrefix + strings.TrimPrefix(queryID, "ct-")
+	}
+	defer trackQuery(ctx, queryID)()
+	seq, alone, done := c.begin()
+	defer done()
+	// запрос выполнялся один, если при старте других не было и после него новые не начинались
+	exclusive := func() bool { return alone && c.started.Load() == seq }
 	var progressMu sync.Mutex
 	progressRows := uint64(0)
 	progressBytes := uint64(0)
+	peakMemory := int64(0)
+	events := make(map[string]uint64)
+	wanted := make(map[string]struct{}, len(c.profileEvents))
+	for _, n := range c.profileEvents {
+		wanted[n] = struct{}{}
+	}
 
-	ctx = clickhouse.Context(ctx,
+	queryOpts := []clickhouse.QueryOption{
 		clickhouse.WithQueryID(queryID),
 		clickhouse.WithProgress(func(p *clickhouse.Progress) {
 			progressMu.Lock()
 			progressRows += p.Rows
 			progressBytes += p.Bytes
 			progressMu.Unlock()
+		}),
+	}
+	if opts.DisableQueryCache {
+		queryOpts = append(queryOpts, clickhouse.WithSettings(clickhouse.Settings{"use_query_cache": 0}))
+	}
+	if !c.useHTTP {
+		// ProfileEvents приходят только по native-протоколу (по блоку на поток/хост).
+		queryOpts = append(queryOpts, clickhouse.WithProfileEvents(func(batch []clickhouse.ProfileEvent) {
+			progressMu.Lock()
+			for _, e := range batch {
+				if e.Name == "MemoryTrackerPeakUsage" && e.Value > peakMemory {
+					peakMemory = e.Value
+				}
+				if _, ok := wanted[e.Name]; ok && e.Type == "increment" && e.Value > 0 {
+					events[e.Name] += uint64(e.Value)
+				}
+			}
+			progressMu.Unlock()
 		}))
+	}
+	ctx = clickhouse.Context(ctx, queryOpts...)
 
+	start := time.Now()
 	rowIter, err := c.conn.Query(ctx, query)
 	if err != nil {
 		return 0, 0, 0, nil, err
@@ -202,16 +314,20 @@ func (c *nativeClient) Query(ctx context.Context, query string) (rows int, readR
 	if err = rowIter.Err(); err != nil {
 		return rows, 0, 0, nil, err
 	}
+	elapsed := time.Since(start)
 
 	progressMu.Lock()
 	readRows = progressRows
 	readBytes = progressBytes
+	memoryPeak := peakMemory
 	progressMu.Unlock()
 
-	if c.useHTTP && readRows == 0 && readBytes == 0 {
+	// по HTTP Progress часто не приходит — тогда read_rows/read_bytes берутся из query_log и без collect_stats
+	if opts.CollectStats || (c.useHTTP && readRows == 0 && readBytes == 0 && !opts.SkipQueryLog) {
+		// освобождаем соединение до lookup (при HTTP пул из одного соединения)
 		_ = rowIter.Close()
-		stats, _ = c.queryLogStats(ctx, queryID)
-		if stats != nil {
+		stats, _ = c.queryLogStats(ctx, queryID, exclusive)
+		if stats != nil && readRows == 0 && readBytes == 0 {
 			readRows = stats.ReadRows
 			readBytes = stats.ReadBytes
 		}
@@ -219,11 +335,81 @@ func (c *nativeClient) Query(ctx context.Context, query string) (rows int, readR
 	if stats == nil {
 		stats = &QueryStats{}
 	}
+	if stats.MemoryUsage == 0 && memoryPeak > 0 {
+		stats.MemoryUsage = uint64(memoryPeak)
+	}
+	if stats.ProfileEvents == nil && len(events) > 0 {
+		stats.ProfileEvents = events
+	}
 	stats.QueryID = queryID
+	stats.Elapsed = elapsed
 
 	return rows, readRows, readBytes, stats, nil
 }
 
+// QueryTable выполняет запрос и возвращает результат таблицей; сохраняются первые maxRows строк (0 — все),
+// остальные только подсчитываются в TotalRows.
+func (c *nativeClient) QueryTable(ctx context.Context, query string, maxRows int) (*ResultTable, error) {
+	queryID := generateQueryID()
+	defer trackQuery(ctx, queryID)()
+	_, _, done := c.begin()
+	defer done()
+	rowIter, err := c.conn.Query(clickhouse.Context(ctx, clickhouse.WithQueryID(queryID)), query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rowIter.Close() }()
+
+	colTypes := rowIter.ColumnTypes()
+	res := &ResultTable{
+		Columns: make([]string, len(colTypes)),
+		Types:   make([]string, len(colTypes)),
+	}
+	dest := make([]any, len(colTypes))
+	for i, ct := range colTypes {
+		res.Columns[i] = ct.Name()
+		res.Types[i] = ct.DatabaseTypeName()
+		dest[i] = reflect.New(ct.ScanType()).Interface()
+	}
+
+	for rowIter.Next() {
+		res.TotalRows++
+		if maxRows > 0 && len(res.Rows) >= maxRows {
+			continue
+		}
+		if err := rowIter.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(dest))
+		for i, d := range dest {
+			row[i] = formatValue(reflect.ValueOf(d).Elem())
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	if err := rowIter.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// formatValue переводит значение колонки в строку (NULL для пустых Nullable, время — в ISO-подобном виде).
+func formatValue(v reflect.Value) string {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "NULL"
+		}
+		v = v.Elem()
+	}
+	switch x := v.Interface().(type) {
+	case time.Time:
+		return x.Format("2006-01-02 15:04:05.999999999")
+	case []byte:
+		return string(x)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
 func generateQueryID() string {
 	return "ct-" + hex.EncodeToString(mustRand(16))
 }
@@ -236,33 +422,55 @@ func mustRand(n int) []byte {
 	return b
 }
 
-// queryLogStats возвращает метрики из query_log (read_rows, read_bytes, memory_usage, partitions) и при заданной таблице — детали партиций из system.parts.
-func (c *nativeClient) queryLogStats(ctx context.Context, queryID string) (*QueryStats, error) {
+// queryLogRow — одна строка system.query_log с нужными колонками.
+type queryLogRow struct {
+	readRows, readBytes, memoryUsage uint64
+	durationMs                       uint64
+	partitions                       string // partitions через \t
+	projections                      string // projections через \t
+	events                           string // значения c.profileEvents через \t (в том же порядке)
+}
+
+// queryLogColumns — список колонок для выборки из query_log; ProfileEvents — только из c.profileEvents.
+func (c *nativeClient) queryLogColumns() string {
+	names := make([]string, 0, len(c.profileEvents))
+	for _, n := range c.profileEvents {
+		names = append(names, "'"+strings.ReplaceAll(n, "'", "''")+"'")
+	}
+	return "read_rows, read_bytes, memory_usage, query_duration_ms, arrayStringConcat(partitions, '\\t') AS parts, arrayStringConcat(projections, '\\t') AS projs, " +
+		"arrayStringConcat(arrayMap(k -> toString(ProfileEvents[k]), CAST([" + strings.Join(names, ", ") + "], 'Array(String)')), '\\t') AS events"
+}
+
+// queryLogStats возвращает метрики из query_log (read_rows, read_bytes, memory_usage, query_duration_ms, partitions, projections, ProfileEvents)
+// и при заданной таблице — детали партиций из system.parts.
+// Если запись по query_id не найдена, берётся последний запрос пользователя за 10 секунд — только когда exclusive()
+// и до, и после выборки: иначе это мог быть запрос другого воркера с чужими памятью, ProfileEvents и проекциями.
+func (c *nativeClient) queryLogStats(ctx context.Context, queryID string, exclusive func() bool) (*QueryStats, error) {
 	bg, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
 
 	var lastErr error
-	// read_rows, read_bytes, memory_usage, partitions (concat by tab)
-	qSelect := "SELECT read_rows, read_bytes, memory_usage, arrayStringConcat(partitions, '\\t') AS parts FROM system.query_log WHERE query_id = '%s' AND type = 2 LIMIT 1"
+	cols := c.queryLogColumns()
+	qSelect := "SELECT " + cols + " FROM system.query_log WHERE query_id = '%s' AND type = 2 LIMIT 1"
 
-	tryRow := func(q string) (r, b, mem uint64, partsStr string, ok bool) {
+	tryRow := func(q string) (queryLogRow, bool) {
+		var row queryLogRow
 		rowIter, qErr := c.conn.Query(bg, q)
 		if qErr != nil {
 			lastErr = qErr
-			return 0, 0, 0, "", false
+			return row, false
 		}
 		defer func() { _ = rowIter.Close() }()
 		if !rowIter.Next() {
 			lastErr = nil
-			return 0, 0, 0, "", false
+			return row, false
 		}
-		var parts string
-		if qErr = rowIter.Scan(&r, &b, &mem, &parts); qErr != nil {
+		if qErr = rowIter.Scan(&row.readRows, &row.readBytes, &row.memoryUsage, &row.durationMs, &row.partitions, &row.projections, &row.events); qErr != nil {
 			lastErr = qErr
-			return 0, 0, 0, "", false
+			return row, false
 		}
 		lastErr = nil
-		return r, b, mem, parts, true
+		return row, true
 	}
 
 	_ = c.conn.Exec(bg, "SYSTEM FLUSH LOGS")
@@ -272,40 +480,77 @@ func (c *nativeClient) queryLogStats(ctx context.Context, queryID string) (*Quer
 		if d > 0 {
 			time.Sleep(d)
 		}
-		if r, b, mem, partsStr, ok := tryRow(qLocal); ok {
-			return c.buildStats(r, b, mem, partsStr), nil
+		if row, ok := tryRow(qLocal); ok {
+			return c.buildStats(row), nil
 		}
 	}
 
 	for _, clusterName := range []string{"default", "cluster"} {
-		q := fmt.Sprintf("SELECT read_rows, read_bytes, memory_usage, arrayStringConcat(partitions, '\\t') AS parts FROM clusterAllReplicas('%s', system.query_log) WHERE query_id = '%s' AND type = 2 LIMIT 1 SETTINGS skip_unavailable_shards = 1", clusterName, queryID)
-		if r, b, mem, partsStr, ok := tryRow(q); ok {
-			return c.buildStats(r, b, mem, partsStr), nil
+		q := fmt.Sprintf("SELECT %s FROM clusterAllReplicas('%s', system.query_log) WHERE query_id = '%s' AND type = 2 LIMIT 1 SETTINGS skip_unavailable_shards = 1", cols, clusterName, queryID)
+		if row, ok := tryRow(q); ok {
+			return c.buildStats(row), nil
 		}
 	}
 
-	qLast := "SELECT read_rows, read_bytes, memory_usage, arrayStringConcat(partitions, '\\t') AS parts FROM system.query_log WHERE user = currentUser() AND type = 2 AND event_time > now() - 10 AND position(query, 'system.query_log') = 0 ORDER BY event_time DESC LIMIT 1"
-	if r, b, mem, partsStr, ok := tryRow(qLast); ok {
-		return c.buildStats(r, b, mem, partsStr), nil
+	qLast := "SELECT " + cols + " FROM system.query_log WHERE user = currentUser() AND type = 2 AND event_time > now() - 10 AND position(query, 'system.query_log') = 0 ORDER BY event_time DESC LIMIT 1"
+	if exclusive() {
+		if row, ok := tryRow(qLast); ok && exclusive() {
+			return c.buildStats(row), nil
+		}
 	}
 
 	if lastErr != nil {
-		log.Printf("[clicktester] HTTP: запрос к query_log: %v", lastErr)
+		log.Printf("[clicktester] запрос к query_log: %v", lastErr)
 	}
-	log.Printf("[clicktester] HTTP: read_rows/read_bytes не получены (query_id=%s). Нужны: log_queries=1, права на system.query_log и при необходимости SYSTEM FLUSH LOGS.", queryID)
+	log.Printf("[clicktester] метрики query_log не получены (query_id=%s). Нужны: log_queries=1, права на system.query_log и при необходимости SYSTEM FLUSH LOGS.", queryID)
 	return nil, nil
 }
 
-func (c *nativeClient) buildStats(readRows, readBytes, memoryUsage uint64, partitionsConcat string) *QueryStats {
-	stats := &QueryStats{ReadRows: readRows, ReadBytes: readBytes, MemoryUsage: memoryUsage}
+func (c *nativeClient) buildStats(row queryLogRow) *QueryStats {
+	stats := &QueryStats{
+		ReadRows:        row.readRows,
+		ReadBytes:       row.readBytes,
+		MemoryUsage:     row.memoryUsage,
+		QueryDurationMs: row.durationMs,
+		FromQueryLog:    true,
+	}
+	if len(c.profileEvents) > 0 {
+		values := strings.Split(row.events, "\t")
+		stats.ProfileEvents = make(map[string]uint64, len(c.profileEvents))
+		for i, name := range c.profileEvents {
+			if i >= len(values) {
+				break
+			}
+			v, err := strconv.ParseUint(values[i], 10, 64)
+			if err != nil {
+				continue
+			}
+			stats.ProfileEvents[name] = v
+		}
+	}
+	for _, p := range strings.Split(row.projections, "\t") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		// query_log.projections содержит полные имена вида "database.table.projection"
+		if idx := strings.LastIndex(p, "."); idx >= 0 && idx < len(p)-1 {
+			p = p[idx+1:]
+		}
+		stats.Projections = append(stats.Projections, p)
+	}
+	partitionsConcat := row.partitions
 	if partitionsConcat != "" {
 		stats.Partitions = strings.Split(partitionsConcat, "\t")
 	}
-	if c.table == "" || c.db == "" || len(stats.Partitions) == 0 {
+	if len(stats.Partitions) == 0 {
 		return stats
 	}
-	// query_log.partitions может быть вида "database.table.7b85c6df..." — извлекаем partition_id (после последней точки) для поиска в system.parts
-	partitionIDs := make([]string, 0, len(stats.Partitions))
+	// query_log.partitions может быть вида "database.table.7b85c6df..." — partition_id после последней точки,
+	// таблица — из префикса (в режиме A/B и при JOIN это не clickhouse.table_name); без префикса — таблица из конфига
+	type tableRef struct{ db, table string }
+	var tables []tableRef
+	partitionIDs := make(map[tableRef][]string)
 	seen := make(map[string]struct{})
 	for _, p := range stats.Partitions {
 		p = strings.TrimSpace(p)
@@ -314,46 +559,57 @@ func (c *nativeClient) buildStats(readRows, readBytes, memoryUsage uint64, parti
 		}
 		// partition_id = часть после последней точки, иначе вся строка
 		pid := p
+		ref := tableRef{db: c.db, table: c.table}
 		if idx := strings.LastIndex(p, "."); idx >= 0 && idx < len(p)-1 {
 			pid = p[idx+1:]
+			if db, tbl, ok := strings.Cut(p[:idx], "."); ok && db != "" && tbl != "" {
+				ref = tableRef{db: db, table: tbl}
+			}
 		}
-		if pid == "" {
+		if pid == "" || ref.db == "" || ref.table == "" {
 			continue
 		}
-		if _, exists := seen[pid]; exists {
+		key := ref.db + "." + ref.table + "." + pid
+		if _, exists := seen[key]; exists {
 			continue
 		}
-		seen[pid] = struct{}{}
-		partitionIDs = append(partitionIDs, "'"+strings.ReplaceAll(pid, "'", "''")+"'")
-	}
-	if len(partitionIDs) == 0 {
-		return stats
-	}
-	// В system.parts ищем по partition_id, возвращаем поле partition (значение партиции), rows, bytes
-	qParts := fmt.Sprintf("SELECT partition, sum(rows) AS r, sum(bytes_on_disk) AS b FROM system.parts WHERE database = '%s' AND table = '%s' AND partition_id IN (%s) AND active GROUP BY partition ORDER BY partition",
-		strings.ReplaceAll(c.db, "'", "''"), strings.ReplaceAll(c.table, "'", "''"), strings.Join(partitionIDs, ","))
-	rowIter, err := c.conn.Query(context.Background(), qParts)
-	if err != nil {
-		return stats
+		seen[key] = struct{}{}
+		if _, ok := partitionIDs[ref]; !ok {
+			tables = append(tables, ref)
+		}
+		partitionIDs[ref] = append(partitionIDs[ref], "'"+strings.ReplaceAll(pid, "'", "''")+"'")
 	}
-	defer func() { _ = rowIter.Close() }()
-	for rowIter.Next() {
-		var part string
-		var r, b uint64
-		if rowIter.Scan(&part, &r, &b) != nil {
+	for _, ref := range tables {
+		// В system.parts ищем по partition_id, возвращаем поле partition (значение партиции), rows, bytes
+		qParts := fmt.Sprintf("SELECT partition, sum(rows) AS r, sum(bytes_on_disk) AS b FROM system.parts WHERE database = '%s' AND table = '%s' AND partition_id IN (%s) AND active GROUP BY partition ORDER BY partition",
+			strings.ReplaceAll(ref.db, "'", "''"), strings.ReplaceAll(ref.table, "'", "''"), strings.Join(partitionIDs[ref], ","))
+		rowIter, err := c.conn.Query(context.Background(), qParts)
+		if err != nil {
 			continue
 		}
-		stats.PartitionDetails = append(stats.PartitionDetails, PartitionInfo{Partition: part, Rows: r, Bytes: b})
+		for rowIter.Next() {
+			var part string
+			var r, b uint64
+			if rowIter.Scan(&part, &r, &b) != nil {
+				continue
+			}
+			stats.PartitionDetails = append(stats.PartitionDetails, PartitionInfo{Partition: part, Rows: r, Bytes: b})
+		}
+		_ = rowIter.Close()
 	}
 	return stats
 }
 
-// Explain выполняет EXPLAIN indexes=1 для запроса и возвращает текст вывода; из текста можно извлечь гранулы через ExtractGranules.
-func (c *nativeClient) Explain(ctx context.Context, query string) (string, error) {
+// Explain выполняет EXPLAIN indexes=1 для запроса и возвращает разобранный план (текст + воронка отсечения по индексам).
+func (c *nativeClient) Explain(ctx context.Context, query string) (*ExplainPlan, error) {
 	explainQuery := "EXPLAIN indexes=1 " + query
-	rowIter, err := c.conn.Query(ctx, explainQuery)
+	queryID := generateQueryID()
+	defer trackQuery(ctx, queryID)()
+	_, _, done := c.begin()
+	defer done()
+	rowIter, err := c.conn.Query(clickhouse.Context(ctx, clickhouse.WithQueryID(queryID)), explainQuery)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer func() { _ = rowIter.Close() }()
 
@@ -380,25 +636,23 @@ func (c *nativeClient) Explain(ctx context.Context, query string) (string, error
 		sb.WriteString("\n")
 	}
 	if err = rowIter.Err(); err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return sb.String(), nil
+	return ParseExplain(sb.String()), nil
 }
 
 // Close закрывает соединение.
 func (c *nativeClient) Close() error {
+	if c.killConn != nil {
+		_ = c.killConn.Close()
+	}
 	return c.conn.Close()
 }
 
 // GranulesRegex — паттерн для строк вида "Granules: 123/456".
 var GranulesRegex = regexp.MustCompile(`Granules:\s*(\d+)/(\d+)`)
 
-// ProjectionUsed возвращает true, если в выводе EXPLAIN встречается упоминание проекции (Projection).
-func ProjectionUsed(explainText string) bool {
-	return strings.Contains(strings.ToLower(explainText), "projection")
-}
-
 // ExtractGranules извлекает минимальное число гранул (первое число в паре X/Y) из вывода EXPLAIN.
 func ExtractGranules(explainText string) int {
 	matches := GranulesRegex.FindAllStringSubmatch(explainText, -1)
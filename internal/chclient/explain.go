@@ -0,0 +1,187 @@
+// Package chclient — разбор вывода EXPLAIN indexes=1 в дерево шагов плана с воронкой отсечения по индексам.
+package chclient
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Типы стадий отсечения в блоке Indexes (порядок применения в ClickHouse).
+const (
+	IndexStageMinMax     = "MinMax"
+	IndexStagePartition  = "Partition"
+	IndexStagePrimaryKey = "PrimaryKey"
+	IndexStageSkip       = "Skip"
+)
+
+// ExplainPlan — результат EXPLAIN indexes=1: исходный текст и дерево шагов плана.
+type ExplainPlan struct {
+	Text  string      // текст вывода EXPLAIN (строки через \n)
+	Steps []*PlanStep // шаги верхнего уровня
+}
+
+// PlanStep — шаг плана запроса (Expression, Sorting, ReadFromMergeTree и т.д.).
+type PlanStep struct {
+	Name     string       // имя шага, например "ReadFromMergeTree"
+	Detail   string       // текст в скобках, например "logs_db.app_logs_v10"
+	Indexes  []IndexStage // стадии отсечения (только у ReadFromMergeTree)
+	Children []*PlanStep
+}
+
+// IndexStage — одна стадия воронки отсечения: части и гранулы до и после применения индекса.
+type IndexStage struct {
+	Stage          string   // MinMax, Partition, PrimaryKey, Skip
+	Name           string   // имя skip-индекса (для Skip)
+	IndexType      string   // тип skip-индекса из Description (bloom_filter, tokenbf_v1, ...)
+	Description    string   // Description как есть, например "tokenbf_v1 GRANULARITY 1"
+	Keys           []string // ключи индекса
+	Condition      string
+	PartsBefore    int
+	PartsAfter     int
+	GranulesBefore int
+	GranulesAfter  int
+}
+
+// ReadSteps возвращает шаги плана, у которых есть блок Indexes (в порядке обхода дерева).
+func (p *ExplainPlan) ReadSteps() []*PlanStep {
+	if p == nil {
+		return nil
+	}
+	var out []*PlanStep
+	var walk func(steps []*PlanStep)
+	walk = func(steps []*PlanStep) {
+		for _, s := range steps {
+			if len(s.Indexes) > 0 {
+				out = append(out, s)
+			}
+			walk(s.Children)
+		}
+	}
+	walk(p.Steps)
+	return out
+}
+
+// ParseExplain разбирает вывод EXPLAIN indexes=1 в дерево шагов.
+// Дочерние шаги смещены на 2 пробела относительно родителя; свойства шага (Indexes:) — на том же уровне, что и шаг.
+func ParseExplain(text string) *ExplainPlan {
+	plan := &ExplainPlan{Text: text}
+
+	type level struct {
+		indent int
+		step   *PlanStep
+	}
+	var stack []level
+
+	var (
+		indexesOf     *PlanStep // шаг, к которому относится текущий блок Indexes
+		indexesIndent = -1
+		stage         *IndexStage
+		stageIndent   int
+		inKeys        bool
+	)
+	flushStage := func() {
+		if stage != nil && indexesOf != nil {
+			indexesOf.Indexes = append(indexesOf.Indexes, *stage)
+		}
+		stage = nil
+		inKeys = false
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+
+		if indexesOf != nil && indent > indexesIndent {
+			if indent == indexesIndent+2 {
+				flushStage()
+				stage = &IndexStage{Stage: trimmed}
+				stageIndent = indent
+				continue
+			}
+			if stage == nil {
+				continue
+			}
+			if inKeys && indent > stageIndent+2 {
+				stage.Keys = append(stage.Keys, trimmed)
+				continue
+			}
+			inKeys = false
+			key, val, _ := strings.Cut(trimmed, ":")
+			val = strings.TrimSpace(val)
+			switch key {
+			case "Keys":
+				if val != "" {
+					stage.Keys = append(stage.Keys, val)
+				}
+				inKeys = true
+			case "Name":
+				stage.Name = val
+			case "Description":
+				stage.Description = val
+				if f := strings.Fields(val); len(f) > 0 {
+					stage.IndexType = f[0]
+				}
+			case "Condition":
+				stage.Condition = val
+			case "Parts":
+				stage.PartsAfter, stage.PartsBefore = parseRatio(val)
+			case "Granules":
+				stage.GranulesAfter, stage.GranulesBefore = parseRatio(val)
+			}
+			continue
+		}
+		if indexesOf != nil {
+			flushStage()
+			indexesOf = nil
+			indexesIndent = -1
+		}
+
+		if trimmed == "Indexes:" {
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].indent <= indent {
+					indexesOf = stack[i].step
+					break
+				}
+			}
+			indexesIndent = indent
+			continue
+		}
+		if strings.Contains(trimmed, ":") {
+			// прочие свойства шага (ReadType:, Parts: и т.п.) не разбираем
+			continue
+		}
+
+		step := &PlanStep{Name: trimmed}
+		if i := strings.Index(trimmed, " ("); i > 0 && strings.HasSuffix(trimmed, ")") {
+			step.Name = trimmed[:i]
+			step.Detail = trimmed[i+2 : len(trimmed)-1]
+		}
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			plan.Steps = append(plan.Steps, step)
+		} else {
+			parent := stack[len(stack)-1].step
+			parent.Children = append(parent.Children, step)
+		}
+		stack = append(stack, level{indent: indent, step: step})
+	}
+	flushStage()
+	return plan
+}
+
+// parseRatio разбирает строку вида "12/345" в (12, 345); при ошибке — нули.
+func parseRatio(s string) (x, y int) {
+	a, b, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, 0
+	}
+	x, _ = strconv.Atoi(strings.TrimSpace(a))
+	y, _ = strconv.Atoi(strings.TrimSpace(b))
+	return x, y
+}
@@ -0,0 +1,74 @@
+// Package chclient — учёт выполняющихся запросов и их остановка на сервере (KILL QUERY).
+package chclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// QueryTracker — множество query_id, которые клиент выполняет в рамках одного прогона.
+// Нужен для отмены: по HTTP отмена контекста только рвёт соединение, а запрос продолжает работать на сервере.
+type QueryTracker struct {
+	mu  sync.Mutex
+	ids map[string]struct{}
+}
+
+type trackerKey struct{}
+
+// WithQueryTracker возвращает контекст, запросы в котором регистрируются в трекере на время выполнения.
+func WithQueryTracker(ctx context.Context) (context.Context, *QueryTracker) {
+	t := &QueryTracker{ids: make(map[string]struct{})}
+	return context.WithValue(ctx, trackerKey{}, t), t
+}
+
+// Active возвращает query_id запросов, выполняющихся в данный момент (по возрастанию).
+func (t *QueryTracker) Active() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]string, 0, len(t.ids))
+	for id := range t.ids {
+		out = append(out, id)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// trackQuery регистрирует queryID в трекере из ctx (если он есть); возвращённая функция снимает регистрацию.
+func trackQuery(ctx context.Context, queryID string) func() {
+	t, ok := ctx.Value(trackerKey{}).(*QueryTracker)
+	if !ok {
+		return func() {}
+	}
+	t.mu.Lock()
+	t.ids[queryID] = struct{}{}
+	t.mu.Unlock()
+	return func() {
+		t.mu.Lock()
+		delete(t.ids, queryID)
+		t.mu.Unlock()
+	}
+}
+
+// KillQueries останавливает запросы с указанными query_id на сервере.
+// ctx должен быть отдельным от отменённого контекста прогона, иначе KILL не будет отправлен.
+// По HTTP KILL идёт через отдельное соединение без сессии (см. nativeClient.killConn).
+func (c *nativeClient) KillQueries(ctx context.Context, queryIDs []string) error {
+	if len(queryIDs) == 0 {
+		return nil
+	}
+	conn := c.conn
+	if c.killConn != nil {
+		conn = c.killConn
+	}
+	quoted := make([]string, len(queryIDs))
+	for i, id := range queryIDs {
+		quoted[i] = "'" + strings.ReplaceAll(id, "'", "''") + "'"
+	}
+	if err := conn.Exec(ctx, "KILL QUERY WHERE query_id IN ("+strings.Join(quoted, ", ")+")"); err != nil {
+		return fmt.Errorf("kill query: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Package chclient — чтение фактической структуры таблицы из system.tables, system.columns и system.data_skipping_indices.
+package chclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"clicktester/internal/ddl"
+)
+
+// TableSchema — структура таблицы на сервере.
+type TableSchema struct {
+	Database     string
+	Table        string
+	Engine       string
+	PartitionKey string
+	SortingKey   string // ORDER BY (system.tables.sorting_key, без внешних скобок)
+	PrimaryKey   string
+	CreateQuery  string // create_table_query из system.tables
+	Columns      []ColumnInfo
+	SkipIndices  []SkipIndexInfo
+	DDL          *ddl.Table // разобранный CreateQuery (TTL, SETTINGS, проекции, типы индексов с аргументами)
+}
+
+// ColumnInfo — колонка из system.columns.
+type ColumnInfo struct {
+	Name        string
+	Type        string
+	Codec       string // compression_codec без обёртки CODEC(...)
+	DefaultKind string
+	DefaultExpr string
+}
+
+// SkipIndexInfo — data skipping индекс из system.data_skipping_indices.
+type SkipIndexInfo struct {
+	Name        string
+	Type        string // тип без аргументов (bloom_filter, tokenbf_v1, ...)
+	Expr        string
+	Granularity uint64
+}
+
+// DescribeTable читает фактическую структуру таблицы database.table.
+func (c *nativeClient) DescribeTable(ctx context.Context, database, table string) (*TableSchema, error) {
+	db := strings.ReplaceAll(database, "'", "''")
+	tbl := strings.ReplaceAll(table, "'", "''")
+	s := &TableSchema{Database: database, Table: table}
+
+	rowIter, err := c.conn.Query(ctx, fmt.Sprintf(
+		"SELECT engine, partition_key, sorting_key, primary_key, create_table_query FROM system.tables WHERE database = '%s' AND name = '%s'", db, tbl))
+	if err != nil {
+		return nil, fmt.Errorf("system.tables: %w", err)
+	}
+	found := false
+	if rowIter.Next() {
+		found = true
+		if err := rowIter.Scan(&s.Engine, &s.PartitionKey, &s.SortingKey, &s.PrimaryKey, &s.CreateQuery); err != nil {
+			_ = rowIter.Close()
+			return nil, fmt.Errorf("system.tables: %w", err)
+		}
+	}
+	err = rowIter.Err()
+	_ = rowIter.Close()
+	if err != nil {
+		return nil, fmt.Errorf("system.tables: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("table %s.%s not found", database, table)
+	}
+
+	rowIter, err = c.conn.Query(ctx, fmt.Sprintf(
+		"SELECT name, type, compression_codec, default_kind, default_expression FROM system.columns WHERE database = '%s' AND table = '%s' ORDER BY position", db, tbl))
+	if err != nil {
+		return nil, fmt.Errorf("system.columns: %w", err)
+	}
+	for rowIter.Next() {
+		var col ColumnInfo
+		if err := rowIter.Scan(&col.Name, &col.Type, &col.Codec, &col.DefaultKind, &col.DefaultExpr); err != nil {
+			_ = rowIter.Close()
+			return nil, fmt.Errorf("system.columns: %w", err)
+		}
+		col.Codec = ddl.NormalizeCodec(col.Codec)
+		s.Columns = append(s.Columns, col)
+	}
+	err = rowIter.Err()
+	_ = rowIter.Close()
+	if err != nil {
+		return nil, fmt.Errorf("system.columns: %w", err)
+	}
+
+	rowIter, err = c.conn.Query(ctx, fmt.Sprintf(
+		"SELECT name, type, expr, granularity FROM system.data_skipping_indices WHERE database = '%s' AND table = '%s'", db, tbl))
+	if err != nil {
+		return nil, fmt.Errorf("system.data_skipping_indices: %w", err)
+	}
+	for rowIter.Next() {
+		var idx SkipIndexInfo
+		if err := rowIter.Scan(&idx.Name, &idx.Type, &idx.Expr, &idx.Granularity); err != nil {
+			_ = rowIter.Close()
+			return nil, fmt.Errorf("system.data_skipping_indices: %w", err)
+		}
+		s.SkipIndices = append(s.SkipIndices, idx)
+	}
+	err = rowIter.Err()
+	_ = rowIter.Close()
+	if err != nil {
+		return nil, fmt.Errorf("system.data_skipping_indices: %w", err)
+	}
+
+	// без разобранного DDL сравнение сочло бы все проекции, TTL и SETTINGS отсутствующими
+	if s.DDL, err = ddl.ParseCreateTable(s.CreateQuery); err != nil {
+		return nil, fmt.Errorf("parse create_table_query: %w", err)
+	}
+	return s, nil
+}
+
+// FormatQuery возвращает запрос в каноническом виде сервера (formatQuerySingleLine, ClickHouse 23.11+):
+// INTERVAL 30 DAY → toIntervalDay(30), a+b → a + b — так же, как выражения записаны в create_table_query.
+func (c *nativeClient) FormatQuery(ctx context.Context, query string) (string, error) {
+	quoted := strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(query)
+	rowIter, err := c.conn.Query(ctx, "SELECT formatQuerySingleLine('"+quoted+"')")
+	if err != nil {
+		return "", fmt.Errorf("formatQuerySingleLine: %w", err)
+	}
+	defer rowIter.Close()
+	var formatted string
+	if rowIter.Next() {
+		if err := rowIter.Scan(&formatted); err != nil {
+			return "", fmt.Errorf("formatQuerySingleLine: %w", err)
+		}
+	}
+	if err := rowIter.Err(); err != nil {
+		return "", fmt.Errorf("formatQuerySingleLine: %w", err)
+	}
+	return formatted, nil
+}
@@ -0,0 +1,112 @@
+// Package chclient — серверные метрики группы запросов из system.query_log (для отчёта стресс-теста).
+package chclient
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QueryLogSummary — сводка system.query_log по запросам с общим префиксом query_id.
+type QueryLogSummary struct {
+	Queries       uint64 // завершённых запросов (QueryFinish и исключения)
+	Exceptions    uint64 // из них с исключением
+	DurationAvgMs float64
+	DurationP50Ms float64
+	DurationP95Ms float64
+	DurationP99Ms float64
+	DurationMaxMs float64
+	ReadRows      uint64
+	ReadBytes     uint64
+	MemoryAvg     float64 // memory_usage, байт
+	MemoryMax     uint64
+	ProfileEvents map[string]uint64 // суммы выбранных ProfileEvents
+	TopExceptions []ExceptionCount  // самые частые коды исключений (до 10)
+}
+
+// ExceptionCount — число запросов с данным кодом исключения.
+type ExceptionCount struct {
+	Code  int32
+	Name  string
+	Count uint64
+}
+
+// QueryLogSummary сбрасывает логи (SYSTEM FLUSH LOGS) и агрегирует system.query_log по запросам,
+// query_id которых начинается с queryIDPrefix, начиная с момента since.
+// Читается локальный query_log: на кластере видны только запросы, пришедшие на этот узел.
+func (c *nativeClient) QueryLogSummary(ctx context.Context, queryIDPrefix string, since time.Time) (*QueryLogSummary, error) {
+	if queryIDPrefix == "" {
+		return nil, fmt.Errorf("query_log summary: empty query_id prefix")
+	}
+	_ = c.conn.Exec(ctx, "SYSTEM FLUSH LOGS")
+
+	names := make([]string, 0, len(c.profileEvents))
+	for _, n := range c.profileEvents {
+		names = append(names, "toString(sum(ProfileEvents['"+strings.ReplaceAll(n, "'", "''")+"']))")
+	}
+	where := fmt.Sprintf("event_date >= toDate(%d) AND event_time >= toDateTime(%d) AND type IN ('QueryFinish', 'ExceptionBeforeStart', 'ExceptionWhileProcessing') AND startsWith(query_id, '%s')",
+		since.Unix(), since.Unix(), strings.ReplaceAll(queryIDPrefix, "'", "''"))
+	q := "SELECT count(), countIf(type != 'QueryFinish'), avg(query_duration_ms), quantiles(0.5, 0.95, 0.99)(query_duration_ms), toFloat64(max(query_duration_ms)), " +
+		"toUInt64(sum(read_rows)), toUInt64(sum(read_bytes)), avg(memory_usage), toUInt64(greatest(max(memory_usage), 0)), " +
+		"arrayStringConcat(CAST([" + strings.Join(names, ", ") + "], 'Array(String)'), '\\t') " +
+		"FROM system.query_log WHERE " + where
+
+	s := &QueryLogSummary{}
+	var quantiles []float64
+	var events string
+	rowIter, err := c.conn.Query(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("query_log summary: %w", err)
+	}
+	if rowIter.Next() {
+		err = rowIter.Scan(&s.Queries, &s.Exceptions, &s.DurationAvgMs, &quantiles, &s.DurationMaxMs, &s.ReadRows, &s.ReadBytes, &s.MemoryAvg, &s.MemoryMax, &events)
+	}
+	if err == nil {
+		err = rowIter.Err()
+	}
+	_ = rowIter.Close()
+	if err != nil {
+		return nil, fmt.Errorf("query_log summary: %w", err)
+	}
+	if s.Queries == 0 {
+		// avg по пустой выборке — nan
+		return &QueryLogSummary{}, nil
+	}
+	if len(quantiles) == 3 {
+		s.DurationP50Ms, s.DurationP95Ms, s.DurationP99Ms = quantiles[0], quantiles[1], quantiles[2]
+	}
+	if len(c.profileEvents) > 0 {
+		values := strings.Split(events, "\t")
+		s.ProfileEvents = make(map[string]uint64, len(c.profileEvents))
+		for i, name := range c.profileEvents {
+			if i >= len(values) {
+				break
+			}
+			if v, err := strconv.ParseUint(values[i], 10, 64); err == nil {
+				s.ProfileEvents[name] = v
+			}
+		}
+	}
+
+	if s.Exceptions > 0 {
+		rowIter, err := c.conn.Query(ctx, "SELECT exception_code, errorCodeToName(exception_code), count() FROM system.query_log WHERE "+where+
+			" AND exception_code != 0 GROUP BY exception_code ORDER BY count() DESC LIMIT 10")
+		if err != nil {
+			return s, fmt.Errorf("query_log exceptions: %w", err)
+		}
+		defer func() { _ = rowIter.Close() }()
+		for rowIter.Next() {
+			var e ExceptionCount
+			if err := rowIter.Scan(&e.Code, &e.Name, &e.Count); err != nil {
+				return s, fmt.Errorf("query_log exceptions: %w", err)
+			}
+			s.TopExceptions = append(s.TopExceptions, e)
+		}
+		if err := rowIter.Err(); err != nil {
+			return s, fmt.Errorf("query_log exceptions: %w", err)
+		}
+	}
+	return s, nil
+}
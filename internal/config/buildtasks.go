@@ -3,9 +3,11 @@ package config
 
 import (
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 
+	"clicktester/internal/ddl"
 	"clicktester/internal/tests"
 )
 
@@ -29,17 +31,59 @@ func BuildTasks(cfg *Config) ([]tests.Task, error) {
 		if desc == "" {
 			desc = structureDescription(sc.Type)
 		}
+		var reference *ddl.Table
+		if sc.Type == "ddl_drift" {
+			reference, err = loadReferenceDDL(sc.ReferenceDDL)
+			if err != nil {
+				return nil, fmt.Errorf("structure check %q: %w", sc.Name, err)
+			}
+		}
 		out = append(out, tests.Task{
 			ID:          id,
 			Name:        sc.Name,
 			Description: desc,
 			Type:        tests.TaskTypeStructure,
 			Query:       q,
-			Opts:        tests.TaskOpts{},
+			Opts: tests.TaskOpts{
+				Database:      db,
+				Table:         table,
+				Expect:        structureSpec(sc.Expect),
+				ReferenceDDL:  reference,
+				MaxResultRows: cfg.Execution.MaxResultRows,
+			},
 		})
 		id++
 	}
 
+	out = append(out, buildQueryTasks(cfg, fullTable, id)...)
+	return out, nil
+}
+
+// BuildComparisonTasks формирует задачи A/B-сравнения: query_templates с подстановкой comparison.table_a и table_b.
+// Задачи с одинаковым индексом в a и b — один и тот же шаблон; ID у b продолжают нумерацию a.
+func BuildComparisonTasks(cfg *Config) (a, b []tests.Task, err error) {
+	if cfg.Comparison == nil {
+		return nil, nil, fmt.Errorf("comparison section is required")
+	}
+	if len(cfg.QueryTemplates) == 0 {
+		return nil, nil, fmt.Errorf("comparison: query_templates are empty")
+	}
+	a = buildQueryTasks(cfg, ComparisonTable(cfg, cfg.Comparison.TableA), 1)
+	b = buildQueryTasks(cfg, ComparisonTable(cfg, cfg.Comparison.TableB), len(a)+1)
+	return a, b, nil
+}
+
+// ComparisonTable возвращает database.table для таблицы из секции comparison (без точки — в clickhouse.database).
+func ComparisonTable(cfg *Config, table string) string {
+	if strings.Contains(table, ".") {
+		return table
+	}
+	return cfg.ClickHouse.Database + "." + table
+}
+
+// buildQueryTasks формирует задачи из query_templates для таблицы fullTable, нумеруя их с id.
+func buildQueryTasks(cfg *Config, fullTable string, id int) []tests.Task {
+	out := make([]tests.Task, 0, len(cfg.QueryTemplates))
 	for _, qt := range cfg.QueryTemplates {
 		q := SubstituteQueryParams(qt.Query, fullTable, &cfg.TestParams)
 		out = append(out, tests.Task{
@@ -49,14 +93,78 @@ func BuildTasks(cfg *Config) ([]tests.Task, error) {
 			Type:        tests.TaskTypeQuery,
 			Query:       q,
 			Opts: tests.TaskOpts{
-				CollectExplain: qt.CollectExplain,
-				CollectStats:   qt.CollectStats,
+				CollectExplain: qt.CollectExplain || qt.MaxGranules > 0 || qt.ExpectIndexUsed != "",
+				CollectStats:   qt.CollectStats || qt.ExpectProjection != "" || qt.MaxReadRows > 0 || qt.MaxReadBytes > 0,
+				Assertions:     taskAssertions(qt.Assertions),
+				Iterations:     intOverride(qt.Iterations, cfg.Execution.Iterations, 1),
+				Warmup:         intOverride(qt.Warmup, cfg.Execution.Warmup, 0),
+				CacheMode:      tests.CacheMode(cfg.Execution.CacheMode),
 			},
 		})
 		id++
 	}
+	return out
+}
 
-	return out, nil
+// intOverride возвращает значение шаблона, если оно задано, иначе общее из execution; результат не меньше floor.
+func intOverride(v *int, def, floor int) int {
+	n := def
+	if v != nil {
+		n = *v
+	}
+	if n < floor {
+		n = floor
+	}
+	return n
+}
+
+// taskAssertions переносит ожидания шаблона из конфига в опции задачи.
+func taskAssertions(a Assertions) tests.Assertions {
+	return tests.Assertions{
+		MaxGranules:      a.MaxGranules,
+		MaxReadRows:      a.MaxReadRows,
+		MaxReadBytes:     a.MaxReadBytes,
+		MaxDurationMs:    a.MaxDurationMs,
+		MinRowsReturned:  a.MinRowsReturned,
+		ExpectProjection: a.ExpectProjection,
+		ExpectIndexUsed:  a.ExpectIndexUsed,
+	}
+}
+
+// structureSpec переносит эталон структурной проверки из конфига в опции задачи (nil — без эталона).
+func structureSpec(e *StructureExpect) *tests.StructureSpec {
+	if e == nil {
+		return nil
+	}
+	spec := &tests.StructureSpec{
+		Projections:      e.Projections,
+		OrderBy:          e.OrderBy,
+		PrimaryKey:       e.PrimaryKey,
+		PartitionBy:      e.PartitionBy,
+		TTL:              e.TTL,
+		IndexGranularity: e.IndexGranularity,
+		Codecs:           e.Codecs,
+	}
+	for _, idx := range e.Indexes {
+		spec.Indexes = append(spec.Indexes, tests.IndexSpec{Name: idx.Name, Type: idx.Type, Expr: idx.Expr, Granularity: idx.Granularity})
+	}
+	return spec
+}
+
+// loadReferenceDDL читает и разбирает эталонный CREATE TABLE для проверки ddl_drift.
+func loadReferenceDDL(path string) (*ddl.Table, error) {
+	if path == "" {
+		return nil, fmt.Errorf("reference_ddl is required for ddl_drift")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read reference ddl: %w", err)
+	}
+	t, err := ddl.ParseCreateTable(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse reference ddl %s: %w", path, err)
+	}
+	return t, nil
 }
 
 // StressQueryByName возвращает запрос для стресс-теста по имени шаблона (query_templates).
@@ -118,7 +226,7 @@ func structureQuery(checkType, database, table string) (string, error) {
 		return fmt.Sprintf(
 			"SELECT name, partition, part_type, rows FROM system.projection_parts WHERE database = '%s' AND table = '%s'",
 			escapeSingleQuotes(database), escapeSingleQuotes(table)), nil
-	case "granules_settings":
+	case "granules_settings", "ddl_drift":
 		return fmt.Sprintf("SHOW CREATE TABLE %s.%s",
 			escapeIdentifier(database), escapeIdentifier(table)), nil
 	default:
@@ -136,6 +244,8 @@ func structureDescription(checkType string) string {
 		return "Проверка наличия проекций (например counter_with_dims)."
 	case "granules_settings":
 		return "Проверка настроек гранул (SHOW CREATE TABLE)."
+	case "ddl_drift":
+		return "Сравнение таблицы с эталонным DDL: колонки, кодеки, индексы, проекции, ключи, TTL, SETTINGS."
 	default:
 		return ""
 	}
@@ -4,8 +4,12 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"clicktester/internal/tests"
 )
 
 // Config — корневая структура конфигурации.
@@ -15,15 +19,128 @@ type Config struct {
 	Execution       Execution      `yaml:"execution"`
 	Report          Report         `yaml:"report"`
 	StressTest      *StressTest    `yaml:"stress_test"`
+	Comparison      *Comparison    `yaml:"comparison"`
+	Server          Server         `yaml:"server"`
 	StructureChecks []StructureCheck `yaml:"structure_checks"`
 	QueryTemplates []QueryTemplate `yaml:"query_templates"`
 }
 
 // StressTest — параметры стресс-теста: N минут, N потоков, один шаблон запроса с меняющимся смещением времени.
 type StressTest struct {
-	DurationMinutes int    `yaml:"duration_minutes"` // длительность в минутах
-	Workers         int    `yaml:"workers"`         // число горутин (0 = из execution.workers)
-	QueryName       string `yaml:"query_name"`      // name из query_templates (в шаблоне должен быть $time_offset_ms$)
+	DurationMinutes int           `yaml:"duration_minutes"` // длительность в минутах
+	Workers         int           `yaml:"workers"`          // число горутин (0 = из execution.workers)
+	QueryName       string        `yaml:"query_name"`       // name из query_templates (в шаблоне должен быть $time_offset_ms$)
+	Queries         []StressQuery `yaml:"queries"`          // смесь шаблонов с весами; если задана, query_name не используется
+	TargetQPS       float64       `yaml:"target_qps"`       // > 0 — открытая модель: запросов в секунду по часам прихода
+	MaxInFlight     int           `yaml:"max_in_flight"`    // открытая модель: максимум одновременных запросов (0 = workers)
+	Stages          []StressStage `yaml:"stages"`           // профиль нагрузки; если задан, duration_minutes, workers и target_qps не используются
+	OutputPath      string        `yaml:"output_path"`      // HTML-отчёт стресс-теста (JSON — рядом с .json); пусто — report.output_path
+}
+
+// StressQuery — шаблон в смеси стресс-теста: доля запросов пропорциональна weight.
+type StressQuery struct {
+	Name   string  `yaml:"name"`   // name из query_templates
+	Weight float64 `yaml:"weight"` // относительный вес (по умолчанию 1)
+}
+
+// Mix — шаблоны стресс-теста: queries или один query_name с весом 1.
+func (s *StressTest) Mix() []StressQuery {
+	if len(s.Queries) > 0 {
+		return s.Queries
+	}
+	return []StressQuery{{Name: s.QueryName, Weight: 1}}
+}
+
+// StressStage — ступень профиля стресс-теста: цель на duration_sec секунд.
+// Все ступени одной модели: либо workers (закрытая), либо target_qps (открытая).
+type StressStage struct {
+	DurationSec int     `yaml:"duration_sec"` // длительность ступени
+	Workers     int     `yaml:"workers"`      // закрытая модель: число воркеров
+	TargetQPS   float64 `yaml:"target_qps"`   // открытая модель: запросов в секунду
+	Ramp        bool    `yaml:"ramp"`         // цель меняется линейно от предыдущей ступени (для первой — от нуля)
+}
+
+// Duration — длительность стресс-теста: сумма ступеней профиля или duration_minutes.
+func (s *StressTest) Duration() time.Duration {
+	if len(s.Stages) == 0 {
+		return time.Duration(s.DurationMinutes) * time.Minute
+	}
+	var d time.Duration
+	for _, st := range s.Stages {
+		d += time.Duration(st.DurationSec) * time.Second
+	}
+	return d
+}
+
+// ValidateStressStages проверяет профиль стресс-теста: длительности, цели и единую модель нагрузки.
+func ValidateStressStages(stages []StressStage) error {
+	open := false
+	for _, st := range stages {
+		if st.TargetQPS > 0 {
+			open = true
+		}
+	}
+	for i, st := range stages {
+		n := i + 1
+		switch {
+		case st.DurationSec <= 0:
+			return fmt.Errorf("stage %d: duration_sec must be positive", n)
+		case st.Workers < 0 || st.TargetQPS < 0:
+			return fmt.Errorf("stage %d: workers and target_qps must not be negative", n)
+		case open && st.Workers > 0:
+			return fmt.Errorf("stage %d: stages must all use target_qps (open model) or all use workers (closed model)", n)
+		case st.Workers == 0 && st.TargetQPS == 0 && !st.Ramp:
+			return fmt.Errorf("stage %d: workers or target_qps is required (zero target only with ramp)", n)
+		}
+	}
+	return nil
+}
+
+// Comparison — A/B-сравнение (-compare): все query_templates выполняются на двух таблицах поочерёдно.
+type Comparison struct {
+	TableA          string  `yaml:"table_a"`           // имя таблицы или database.table (по умолчанию clickhouse.table_name)
+	TableB          string  `yaml:"table_b"`           // сравниваемая таблица, например app_logs_v11
+	TieThresholdPct float64 `yaml:"tie_threshold_pct"` // разница медиан длительности, ниже которой ничья (по умолчанию 5%)
+}
+
+// Server — параметры режима -serve.
+type Server struct {
+	HistoryDir string     `yaml:"history_dir"` // каталог истории прогонов: JSON-экспорт на каждый прогон (по умолчанию <каталог отчёта>/history)
+	Listen     string     `yaml:"listen"`      // адрес сервера, например 127.0.0.1:8080 (флаг -listen переопределяет; пусто — все интерфейсы, порт -port)
+	Auth       ServerAuth `yaml:"auth"`
+}
+
+// Роли пользователей -serve.
+const (
+	RoleAdmin  = "admin"  // всё, включая запуск и остановку прогонов
+	RoleViewer = "viewer" // только чтение: список тестов, история, отчёты
+)
+
+// ServerAuth — доступ к -serve: Basic (users) и/или Bearer (tokens). Ничего не задано — сервер без аутентификации.
+type ServerAuth struct {
+	Users  []ServerUser  `yaml:"users"`
+	Tokens []ServerToken `yaml:"tokens"`
+}
+
+// ServerUser — пользователь для Basic-аутентификации (браузер).
+type ServerUser struct {
+	Name        string `yaml:"name"`
+	Password    string `yaml:"password"`
+	PasswordEnv string `yaml:"password_env"` // переменная окружения с паролем (вместо password в конфиге)
+	Role        string `yaml:"role"`         // admin (по умолчанию) или viewer
+}
+
+// ServerToken — токен для заголовка Authorization: Bearer (скрипты, CI).
+type ServerToken struct {
+	Name     string `yaml:"name"` // для кого токен (выводится в UI)
+	Token    string `yaml:"token"`
+	TokenEnv string `yaml:"token_env"` // переменная окружения с токеном (вместо token в конфиге)
+	Role     string `yaml:"role"`      // admin (по умолчанию) или viewer
+}
+
+// Enabled сообщает, включена ли аутентификация.
+func (a ServerAuth) Enabled() bool {
+	return len(a.Users) > 0 || len(a.Tokens) > 0
 }
 
 // ClickHouse — параметры подключения к ClickHouse.
@@ -53,14 +170,48 @@ type TestParams struct {
 
 // Execution — параметры выполнения тестов.
 type Execution struct {
-	Workers         int `yaml:"workers"`
-	QueryTimeoutSec int `yaml:"query_timeout_sec"`
+	Workers         int      `yaml:"workers"`
+	QueryTimeoutSec int      `yaml:"query_timeout_sec"`
+	ProfileEvents   []string `yaml:"profile_events"`  // ProfileEvents из query_log для collect_stats (не задано — DefaultProfileEvents)
+	MaxResultRows   int      `yaml:"max_result_rows"` // строк результата структурной проверки в отчёте (по умолчанию 100)
+	Iterations      int      `yaml:"iterations"`      // замеров каждого запроса (по умолчанию 1); при > 1 в отчёте медиана и сводка
+	Warmup          int      `yaml:"warmup"`          // прогревочных запусков перед замерами (по умолчанию 0)
+	CacheMode       string   `yaml:"cache_mode"`      // warm (по умолчанию), cold — сброс кэшей перед замером, both — холодный и тёплый
+}
+
+// DefaultProfileEvents — ProfileEvents, собираемые по умолчанию (отсечение по индексам, кэш засечек, чтение с диска).
+var DefaultProfileEvents = []string{
+	"SelectedParts",
+	"SelectedRanges",
+	"SelectedMarks",
+	"SelectedRows",
+	"SelectedBytes",
+	"MarkCacheHits",
+	"MarkCacheMisses",
+	"ReadCompressedBytes",
+	"OSReadBytes",
+	"RealTimeMicroseconds",
 }
 
 // Report — параметры отчёта.
 type Report struct {
 	OutputPath string     `yaml:"output_path"`
 	Thresholds Thresholds `yaml:"thresholds"`
+	Regression Regression `yaml:"regression"` // пороги регрессии при сравнении с -baseline
+}
+
+// Regression — допустимый рост метрик относительно baseline (granules, read_rows, read_bytes, memory_usage, duration_ms).
+// Если заданы и percent, и absolute, регрессия фиксируется при превышении обоих; ничего не задано — 20%.
+type Regression struct {
+	Percent  float64                        `yaml:"percent"`
+	Absolute float64                        `yaml:"absolute"`
+	Metrics  map[string]RegressionThreshold `yaml:"metrics"` // переопределение порога для отдельной метрики
+}
+
+// RegressionThreshold — порог регрессии одной метрики.
+type RegressionThreshold struct {
+	Percent  float64 `yaml:"percent"`
+	Absolute float64 `yaml:"absolute"`
 }
 
 // Thresholds — пороги для статусов ok/warn/fail.
@@ -72,9 +223,31 @@ type Thresholds struct {
 
 // StructureCheck — одна структурная проверка (партиции, индексы, проекции и т.д.).
 type StructureCheck struct {
+	Name        string           `yaml:"name"`
+	Type        string           `yaml:"type"` // partitions, indexes, projections, granules_settings, ddl_drift
+	Description string           `yaml:"description"`
+	Expect      *StructureExpect `yaml:"expect"`        // эталон; при расхождении проверка падает с перечнем отличий
+	ReferenceDDL string          `yaml:"reference_ddl"` // для ddl_drift: путь к эталонному CREATE TABLE (например Create_db_v11.sql)
+}
+
+// StructureExpect — эталонная структура таблицы; незаданные поля не проверяются.
+type StructureExpect struct {
+	Indexes          []ExpectIndex     `yaml:"indexes"`           // обязательные skip-индексы
+	Projections      []string          `yaml:"projections"`       // обязательные проекции
+	OrderBy          string            `yaml:"order_by"`          // ORDER BY, например "(projectCode, mainTimestampTime)"
+	PrimaryKey       string            `yaml:"primary_key"`
+	PartitionBy      string            `yaml:"partition_by"`
+	TTL              string            `yaml:"ttl"`
+	IndexGranularity int               `yaml:"index_granularity"`
+	Codecs           map[string]string `yaml:"codecs"` // колонка → кодек, например "Delta(8), ZSTD(1)"
+}
+
+// ExpectIndex — ожидаемый data skipping индекс.
+type ExpectIndex struct {
 	Name        string `yaml:"name"`
-	Type        string `yaml:"type"` // partitions, indexes, projections, granules_settings
-	Description string `yaml:"description"`
+	Type        string `yaml:"type"` // bloom_filter, tokenbf_v1 или с аргументами: tokenbf_v1(32768, 3, 0)
+	Expr        string `yaml:"expr"`
+	Granularity int    `yaml:"granularity"`
 }
 
 // QueryTemplate — шаблон запроса с опциями сбора метрик.
@@ -84,6 +257,24 @@ type QueryTemplate struct {
 	Query          string `yaml:"query"`
 	CollectExplain bool   `yaml:"collect_explain"`
 	CollectStats   bool   `yaml:"collect_stats"`
+	Iterations     *int   `yaml:"iterations"` // переопределяет execution.iterations для шаблона
+	Warmup         *int   `yaml:"warmup"`     // переопределяет execution.warmup для шаблона
+	Assertions     `yaml:",inline"`
+}
+
+// Assertions — ожидания шаблона запроса (ключи на уровне шаблона); нулевые значения не проверяются.
+type Assertions struct {
+	MaxGranules     int     `yaml:"max_granules"`       // гранул после отсечения (EXPLAIN), включает collect_explain
+	MaxReadRows     uint64  `yaml:"max_read_rows"`
+	MaxReadBytes    uint64  `yaml:"max_read_bytes"`
+	MaxDurationMs   float64 `yaml:"max_duration_ms"`
+	MinRowsReturned int     `yaml:"min_rows_returned"`
+	// ExpectProjection — имя проекции, которую должен использовать запрос (по query_log.projections);
+	// "true" — любая проекция. Включает collect_stats.
+	ExpectProjection string `yaml:"expect_projection"`
+	// ExpectIndexUsed — имя skip-индекса (или стадия PrimaryKey/MinMax/Partition), который должен отсечь гранулы
+	// по воронке EXPLAIN indexes=1. Включает collect_explain.
+	ExpectIndexUsed string `yaml:"expect_index_used"`
 }
 
 // Load читает конфиг из файла и парсит YAML.
@@ -116,20 +307,151 @@ func validate(c *Config) error {
 	if c.ClickHouse.Port == 0 {
 		c.ClickHouse.Port = 9000 // native protocol (HTTP = 8123)
 	}
+	if c.Comparison != nil && c.Comparison.TableB == "" {
+		return fmt.Errorf("comparison.table_b is required")
+	}
+	if err := ValidateCacheMode(c.Execution.CacheMode); err != nil {
+		return err
+	}
+	if err := resolveServerAuth(&c.Server.Auth); err != nil {
+		return err
+	}
+	if st := c.StressTest; st != nil {
+		if st.TargetQPS < 0 {
+			return fmt.Errorf("stress_test.target_qps must not be negative")
+		}
+		if st.MaxInFlight < 0 {
+			return fmt.Errorf("stress_test.max_in_flight must not be negative")
+		}
+		if err := ValidateStressStages(st.Stages); err != nil {
+			return fmt.Errorf("stress_test.stages: %w", err)
+		}
+		for i, q := range st.Queries {
+			if q.Name == "" {
+				return fmt.Errorf("stress_test.queries[%d]: name is required", i)
+			}
+			if q.Weight < 0 {
+				return fmt.Errorf("stress_test.queries[%d]: weight must not be negative", i)
+			}
+		}
+	}
 	if len(c.StructureChecks) == 0 && len(c.QueryTemplates) == 0 {
 		return fmt.Errorf("at least one structure_checks or query_templates entry is required")
 	}
 	return nil
 }
 
+// ValidateCacheMode проверяет execution.cache_mode (пустое значение — warm).
+func ValidateCacheMode(mode string) error {
+	switch tests.CacheMode(mode) {
+	case "", tests.CacheModeWarm, tests.CacheModeCold, tests.CacheModeBoth:
+		return nil
+	}
+	return fmt.Errorf("execution.cache_mode must be warm, cold or both, got %q", mode)
+}
+
+// resolveServerAuth подставляет секреты из переменных окружения (*_env) и проверяет роли.
+func resolveServerAuth(a *ServerAuth) error {
+	for i := range a.Users {
+		u := &a.Users[i]
+		if u.Name == "" {
+			return fmt.Errorf("server.auth.users[%d]: name is required", i)
+		}
+		secret, err := secretValue(u.Password, u.PasswordEnv)
+		if err != nil {
+			return fmt.Errorf("server.auth.users[%d] (%s): %w", i, u.Name, err)
+		}
+		u.Password = secret
+		if u.Role, err = normalizeRole(u.Role); err != nil {
+			return fmt.Errorf("server.auth.users[%d] (%s): %w", i, u.Name, err)
+		}
+	}
+	for i := range a.Tokens {
+		t := &a.Tokens[i]
+		secret, err := secretValue(t.Token, t.TokenEnv)
+		if err != nil {
+			return fmt.Errorf("server.auth.tokens[%d]: %w", i, err)
+		}
+		t.Token = secret
+		if t.Role, err = normalizeRole(t.Role); err != nil {
+			return fmt.Errorf("server.auth.tokens[%d]: %w", i, err)
+		}
+		if t.Name == "" {
+			t.Name = fmt.Sprintf("token-%d", i+1)
+		}
+	}
+	return nil
+}
+
+// secretValue — секрет из конфига или из переменной окружения env (env приоритетнее); пустой секрет — ошибка.
+func secretValue(value, env string) (string, error) {
+	if env != "" {
+		v, ok := os.LookupEnv(env)
+		if !ok || v == "" {
+			return "", fmt.Errorf("environment variable %s is not set", env)
+		}
+		return v, nil
+	}
+	if value == "" {
+		return "", fmt.Errorf("secret is empty")
+	}
+	return value, nil
+}
+
+func normalizeRole(role string) (string, error) {
+	switch role {
+	case "":
+		return RoleAdmin, nil
+	case RoleAdmin, RoleViewer:
+		return role, nil
+	}
+	return "", fmt.Errorf("role must be %s or %s, got %q", RoleAdmin, RoleViewer, role)
+}
+
 func setDefaults(c *Config) {
 	if c.Execution.Workers <= 0 {
 		c.Execution.Workers = 1
 	}
+	if c.Execution.Iterations <= 0 {
+		c.Execution.Iterations = 1
+	}
+	if c.Execution.Warmup < 0 {
+		c.Execution.Warmup = 0
+	}
+	if c.Execution.CacheMode == "" {
+		c.Execution.CacheMode = string(tests.CacheModeWarm)
+	}
+	if c.Execution.MaxResultRows <= 0 {
+		c.Execution.MaxResultRows = 100
+	}
+	if c.Execution.ProfileEvents == nil {
+		c.Execution.ProfileEvents = append([]string(nil), DefaultProfileEvents...)
+	}
 	if c.Report.OutputPath == "" {
 		c.Report.OutputPath = "reports/report.html"
 	}
+	if c.Server.HistoryDir == "" {
+		c.Server.HistoryDir = filepath.Join(filepath.Dir(c.Report.OutputPath), "history")
+	}
+	if c.Comparison != nil {
+		if c.Comparison.TableA == "" {
+			c.Comparison.TableA = c.ClickHouse.TableName
+		}
+		if c.Comparison.TieThresholdPct <= 0 {
+			c.Comparison.TieThresholdPct = 5
+		}
+	}
 	if c.StressTest != nil && c.StressTest.Workers <= 0 {
 		c.StressTest.Workers = c.Execution.Workers
 	}
+	if c.StressTest != nil && c.StressTest.MaxInFlight <= 0 {
+		c.StressTest.MaxInFlight = c.StressTest.Workers
+	}
+	if c.StressTest != nil {
+		for i := range c.StressTest.Queries {
+			if c.StressTest.Queries[i].Weight == 0 {
+				c.StressTest.Queries[i].Weight = 1
+			}
+		}
+	}
 }
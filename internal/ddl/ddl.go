@@ -0,0 +1,547 @@
+// Package ddl — разбор CREATE TABLE (ClickHouse MergeTree) на составные части: колонки, индексы, проекции, ключи, TTL, SETTINGS.
+// Используется для сравнения живой таблицы (SHOW CREATE TABLE / system.tables) с эталоном.
+package ddl
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Table — разобранный CREATE TABLE.
+type Table struct {
+	Name        string // имя как в DDL (например logs_db.app_logs_v10)
+	Columns     []Column
+	Indexes     []Index
+	Projections []Projection
+	Engine      string // Engine вместе с аргументами, например ReplicatedMergeTree('/path', '{replica}')
+	PartitionBy string
+	OrderBy     string
+	PrimaryKey  string
+	SampleBy    string
+	TTL         string
+	Settings    map[string]string
+	Source      string // текст разобранного оператора CREATE TABLE без комментариев
+}
+
+// Column — колонка таблицы.
+type Column struct {
+	Name        string
+	Type        string
+	DefaultKind string // DEFAULT, MATERIALIZED, ALIAS, EPHEMERAL
+	DefaultExpr string
+	Codec       string // содержимое CODEC(...), например "Delta(8), ZSTD(1)"
+	TTL         string
+	Comment     string
+}
+
+// Index — data skipping индекс.
+type Index struct {
+	Name        string
+	Expr        string
+	Type        string // тип с аргументами, например tokenbf_v1(32768, 3, 0)
+	Granularity int
+}
+
+// Projection — проекция таблицы.
+type Projection struct {
+	Name  string
+	Query string // тело проекции без внешних скобок
+}
+
+// Column возвращает колонку по имени или nil.
+func (t *Table) Column(name string) *Column {
+	for i := range t.Columns {
+		if t.Columns[i].Name == name {
+			return &t.Columns[i]
+		}
+	}
+	return nil
+}
+
+// Index возвращает индекс по имени или nil.
+func (t *Table) Index(name string) *Index {
+	for i := range t.Indexes {
+		if t.Indexes[i].Name == name {
+			return &t.Indexes[i]
+		}
+	}
+	return nil
+}
+
+// Projection возвращает проекцию по имени или nil.
+func (t *Table) Projection(name string) *Projection {
+	for i := range t.Projections {
+		if t.Projections[i].Name == name {
+			return &t.Projections[i]
+		}
+	}
+	return nil
+}
+
+// tableClauses — ключевые слова после списка колонок (в порядке, допустимом в ClickHouse).
+var tableClauses = []string{"ENGINE", "PARTITION BY", "PRIMARY KEY", "ORDER BY", "SAMPLE BY", "TTL", "SETTINGS", "COMMENT"}
+
+// columnClauses — ключевые слова в описании колонки после типа.
+var columnClauses = []string{"DEFAULT", "MATERIALIZED", "ALIAS", "EPHEMERAL", "CODEC", "TTL", "COMMENT"}
+
+// ParseCreateTable разбирает первый оператор CREATE TABLE в тексте sql (комментарии -- и /* */ допускаются).
+func ParseCreateTable(sql string) (*Table, error) {
+	s := stripComments(sql)
+	start := findKeyword(s, "CREATE", 0)
+	if start < 0 {
+		return nil, fmt.Errorf("CREATE TABLE not found")
+	}
+	tablePos := findKeyword(s, "TABLE", start)
+	if tablePos < 0 {
+		return nil, fmt.Errorf("CREATE TABLE not found")
+	}
+	rest := s[tablePos+len("TABLE"):]
+	if i := indexTopLevel(rest, ';'); i >= 0 {
+		rest = rest[:i]
+	}
+
+	open := strings.Index(rest, "(")
+	if open < 0 {
+		return nil, fmt.Errorf("column list not found")
+	}
+	header := strings.Fields(rest[:open])
+	if len(header) > 0 && strings.EqualFold(header[0], "IF") {
+		// IF NOT EXISTS
+		header = header[min(3, len(header)):]
+	}
+	t := &Table{Settings: map[string]string{}, Source: strings.TrimSpace(s[start:tablePos+len("TABLE")] + rest)}
+	if len(header) > 0 {
+		t.Name = unquoteIdent(header[0])
+	}
+	closePos := matchParen(rest, open)
+	if closePos < 0 {
+		return nil, fmt.Errorf("unbalanced parentheses in column list")
+	}
+	for _, el := range splitTopLevel(rest[open+1:closePos], ',') {
+		el = strings.TrimSpace(el)
+		if el == "" {
+			continue
+		}
+		if err := t.addElement(el); err != nil {
+			return nil, err
+		}
+	}
+
+	clauses := splitClauses(rest[closePos+1:], tableClauses)
+	for kw, val := range clauses {
+		switch kw {
+		case "ENGINE":
+			t.Engine = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(val), "="))
+		case "PARTITION BY":
+			t.PartitionBy = val
+		case "PRIMARY KEY":
+			t.PrimaryKey = val
+		case "ORDER BY":
+			t.OrderBy = val
+		case "SAMPLE BY":
+			t.SampleBy = val
+		case "TTL":
+			t.TTL = val
+		case "SETTINGS":
+			for _, kv := range splitTopLevel(val, ',') {
+				k, v, ok := strings.Cut(kv, "=")
+				if !ok {
+					continue
+				}
+				t.Settings[strings.TrimSpace(k)] = strings.Trim(strings.TrimSpace(v), "'")
+			}
+		}
+	}
+	return t, nil
+}
+
+// addElement разбирает элемент списка в скобках: колонку, INDEX, PROJECTION, CONSTRAINT или PRIMARY KEY.
+func (t *Table) addElement(el string) error {
+	word, rest := firstWord(el)
+	switch strings.ToUpper(word) {
+	case "INDEX":
+		name, body := firstWord(rest)
+		idx := Index{Name: unquoteIdent(name)}
+		typePos := findKeyword(body, "TYPE", 0)
+		if typePos < 0 {
+			return fmt.Errorf("index %s: TYPE not found", idx.Name)
+		}
+		idx.Expr = Normalize(body[:typePos])
+		typeAndGran := body[typePos+len("TYPE"):]
+		if g := findKeyword(typeAndGran, "GRANULARITY", 0); g >= 0 {
+			fmt.Sscanf(strings.TrimSpace(typeAndGran[g+len("GRANULARITY"):]), "%d", &idx.Granularity)
+			typeAndGran = typeAndGran[:g]
+		}
+		idx.Type = Normalize(typeAndGran)
+		t.Indexes = append(t.Indexes, idx)
+	case "PROJECTION":
+		name, body := firstWord(rest)
+		t.Projections = append(t.Projections, Projection{Name: unquoteIdent(name), Query: Normalize(stripOuterParens(body))})
+	case "CONSTRAINT":
+		// ограничения не сравниваем
+	case "PRIMARY":
+		if w, r := firstWord(rest); strings.EqualFold(w, "KEY") {
+			t.PrimaryKey = strings.TrimSpace(r)
+		}
+	default:
+		col := Column{Name: unquoteIdent(word)}
+		clauses := splitClauses(rest, columnClauses)
+		col.Type = Normalize(clauses[""])
+		for _, kind := range []string{"DEFAULT", "MATERIALIZED", "ALIAS", "EPHEMERAL"} {
+			if v, ok := clauses[kind]; ok {
+				col.DefaultKind = kind
+				col.DefaultExpr = Normalize(v)
+			}
+		}
+		if v, ok := clauses["CODEC"]; ok {
+			col.Codec = NormalizeCodec(v)
+		}
+		col.TTL = Normalize(clauses["TTL"])
+		col.Comment = strings.Trim(strings.TrimSpace(clauses["COMMENT"]), "'")
+		t.Columns = append(t.Columns, col)
+	}
+	return nil
+}
+
+// Normalize приводит выражение к каноническому виду для сравнения: схлопывает пробелы,
+// убирает обратные кавычки и пробелы у скобок (в том числе между именем и "(": "toDate (ts)" → "toDate(ts)"),
+// ставит ", " между аргументами, снимает внешние скобки.
+func Normalize(expr string) string {
+	var sb strings.Builder
+	inStr := false
+	space := false
+	for _, r := range strings.TrimSpace(expr) {
+		if inStr {
+			sb.WriteRune(r)
+			if r == '\'' {
+				inStr = false
+			}
+			continue
+		}
+		switch {
+		case r == '\'':
+			if out := sb.String(); space && out != "" && !strings.HasSuffix(out, "(") && !strings.HasSuffix(out, " ") {
+				sb.WriteByte(' ')
+			}
+			space = false
+			inStr = true
+			sb.WriteRune(r)
+		case r == '`':
+		case unicode.IsSpace(r):
+			space = true
+		case r == ',':
+			sb.WriteString(", ")
+			space = false
+		case r == ')':
+			sb.WriteRune(r)
+			space = false
+		case r == '(':
+			if out := sb.String(); space && out != "" && !isIdentChar(out[len(out)-1]) && !strings.HasSuffix(out, "(") && !strings.HasSuffix(out, " ") {
+				sb.WriteByte(' ')
+			}
+			space = false
+			sb.WriteRune(r)
+		default:
+			out := sb.String()
+			if space && out != "" && !strings.HasSuffix(out, "(") && !strings.HasSuffix(out, " ") {
+				sb.WriteByte(' ')
+			}
+			space = false
+			sb.WriteRune(r)
+		}
+	}
+	return stripOuterParens(strings.TrimSpace(sb.String()))
+}
+
+// NormalizeCodec приводит описание кодека к виду "Delta(8), ZSTD(1)" (без обёртки CODEC(...)).
+func NormalizeCodec(codec string) string {
+	c := strings.TrimSpace(codec)
+	if len(c) >= 5 && strings.EqualFold(c[:5], "CODEC") {
+		c = strings.TrimSpace(c[5:])
+	}
+	return Normalize(c)
+}
+
+// codecDefaults — аргументы, которые ClickHouse дописывает к кодеку, указанному без них.
+var codecDefaults = map[string]string{
+	"zstd":  "ZSTD(1)",
+	"lz4hc": "LZ4HC(9)",
+}
+
+// codecWidthDefaults — кодеки, аргумент по умолчанию которых зависит от ширины типа колонки
+// (Delta → Delta(8) для UInt64, Delta(4) для DateTime): без аргументов совпадают с любым.
+var codecWidthDefaults = map[string]bool{
+	"delta":       true,
+	"doubledelta": true,
+	"gorilla":     true,
+}
+
+// CodecsEqual сравнивает кодек таблицы (как в system.columns) с эталонным с учётом аргументов,
+// которые ClickHouse подставляет сам: ZSTD → ZSTD(1), Delta → Delta(ширина типа).
+func CodecsEqual(live, ref string) bool {
+	l, r := NormalizeCodec(live), NormalizeCodec(ref)
+	if l == r {
+		return true
+	}
+	lp, rp := splitTopLevel(l, ','), splitTopLevel(r, ',')
+	if len(lp) != len(rp) {
+		return false
+	}
+	for i := range rp {
+		lc, rc := strings.TrimSpace(lp[i]), strings.TrimSpace(rp[i])
+		switch {
+		case strings.EqualFold(lc, rc):
+		case strings.Contains(rc, "("):
+			return false
+		case strings.EqualFold(lc, codecDefaults[strings.ToLower(rc)]):
+		case codecWidthDefaults[strings.ToLower(rc)] && strings.EqualFold(BaseType(lc), rc):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// BaseType возвращает имя типа без аргументов: "tokenbf_v1(32768, 3, 0)" → "tokenbf_v1".
+func BaseType(typ string) string {
+	if i := strings.Index(typ, "("); i >= 0 {
+		return strings.TrimSpace(typ[:i])
+	}
+	return strings.TrimSpace(typ)
+}
+
+// stripComments удаляет комментарии -- ... и /* ... */ вне строковых литералов.
+func stripComments(s string) string {
+	var sb strings.Builder
+	inStr := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inStr {
+			sb.WriteByte(c)
+			if c == '\\' && i+1 < len(s) {
+				i++
+				sb.WriteByte(s[i])
+			} else if c == '\'' {
+				inStr = false
+			}
+			continue
+		}
+		switch {
+		case c == '\'':
+			inStr = true
+			sb.WriteByte(c)
+		case c == '-' && i+1 < len(s) && s[i+1] == '-':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+			sb.WriteByte('\n')
+		case c == '/' && i+1 < len(s) && s[i+1] == '*':
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return sb.String()
+			}
+			i += end + 3
+			sb.WriteByte(' ')
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// scanTopLevel вызывает fn для каждой позиции вне строк, скобок и идентификаторов в обратных кавычках.
+// fn возвращает false, чтобы прервать обход.
+func scanTopLevel(s string, fn func(i int) bool) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '`', '"':
+			quote = c
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		default:
+			if depth == 0 && !fn(i) {
+				return
+			}
+		}
+	}
+}
+
+func indexTopLevel(s string, sep byte) int {
+	pos := -1
+	scanTopLevel(s, func(i int) bool {
+		if s[i] == sep {
+			pos = i
+			return false
+		}
+		return true
+	})
+	return pos
+}
+
+func splitTopLevel(s string, sep byte) []string {
+	var out []string
+	last := 0
+	scanTopLevel(s, func(i int) bool {
+		if s[i] == sep {
+			out = append(out, s[last:i])
+			last = i + 1
+		}
+		return true
+	})
+	return append(out, s[last:])
+}
+
+// findKeyword ищет ключевое слово (или фразу через пробел) вне скобок/строк начиная с from; регистр не учитывается.
+func findKeyword(s, kw string, from int) int {
+	words := strings.Fields(strings.ToUpper(kw))
+	pos := -1
+	scanTopLevel(s, func(i int) bool {
+		if i < from || (i > 0 && isIdentChar(s[i-1])) {
+			return true
+		}
+		j := i
+		for wi, w := range words {
+			if wi > 0 {
+				k := j
+				for k < len(s) && unicode.IsSpace(rune(s[k])) {
+					k++
+				}
+				if k == j {
+					return true
+				}
+				j = k
+			}
+			if j+len(w) > len(s) || !strings.EqualFold(s[j:j+len(w)], w) {
+				return true
+			}
+			j += len(w)
+		}
+		if j < len(s) && isIdentChar(s[j]) {
+			return true
+		}
+		pos = i
+		return false
+	})
+	return pos
+}
+
+// splitClauses делит текст на секции по ключевым словам верхнего уровня.
+// Текст до первого ключевого слова возвращается под ключом "".
+func splitClauses(s string, keywords []string) map[string]string {
+	type hit struct {
+		kw  string
+		pos int
+	}
+	var hits []hit
+	for _, kw := range keywords {
+		from := 0
+		for {
+			p := findKeyword(s, kw, from)
+			if p < 0 {
+				break
+			}
+			hits = append(hits, hit{kw, p})
+			from = p + len(kw)
+		}
+	}
+	// сортировка по позиции; при совпадении позиции (PRIMARY KEY vs ...) берём первое найденное
+	for i := 1; i < len(hits); i++ {
+		for j := i; j > 0 && hits[j].pos < hits[j-1].pos; j-- {
+			hits[j], hits[j-1] = hits[j-1], hits[j]
+		}
+	}
+	out := make(map[string]string, len(hits)+1)
+	end := len(s)
+	if len(hits) > 0 {
+		end = hits[0].pos
+	}
+	out[""] = strings.TrimSpace(s[:end])
+	for i, h := range hits {
+		end := len(s)
+		if i+1 < len(hits) {
+			end = hits[i+1].pos
+		}
+		if _, seen := out[h.kw]; seen {
+			continue
+		}
+		out[h.kw] = strings.TrimSpace(s[h.pos+len(h.kw) : end])
+	}
+	return out
+}
+
+func matchParen(s string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '`', '"':
+			quote = c
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func stripOuterParens(s string) string {
+	s = strings.TrimSpace(s)
+	for len(s) >= 2 && s[0] == '(' && matchParen(s, 0) == len(s)-1 {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	return s
+}
+
+// firstWord возвращает первое слово (идентификатор, возможно в обратных кавычках) и остаток строки.
+func firstWord(s string) (word, rest string) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "`") {
+		if end := strings.Index(s[1:], "`"); end >= 0 {
+			return s[:end+2], strings.TrimSpace(s[end+2:])
+		}
+	}
+	i := strings.IndexFunc(s, func(r rune) bool { return unicode.IsSpace(r) || r == '(' })
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i:])
+}
+
+func unquoteIdent(s string) string {
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	for i, p := range parts {
+		parts[i] = strings.Trim(p, "`\"")
+	}
+	return strings.Join(parts, ".")
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
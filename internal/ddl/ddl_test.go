@@ -0,0 +1,138 @@
+// Package ddl — тесты разбора CREATE TABLE и нормализации выражений и кодеков.
+package ddl
+
+import "testing"
+
+func TestParseCreateTable(t *testing.T) {
+	tests := []struct {
+		name  string
+		sql   string
+		check func(t *testing.T, tbl *Table)
+	}{
+		{
+			name: "if not exists",
+			sql:  "CREATE TABLE IF NOT EXISTS logs_db.app_logs (ts DateTime) ENGINE = MergeTree ORDER BY ts",
+			check: func(t *testing.T, tbl *Table) {
+				if tbl.Name != "logs_db.app_logs" {
+					t.Errorf("Name = %q, want logs_db.app_logs", tbl.Name)
+				}
+				if tbl.Engine != "MergeTree" {
+					t.Errorf("Engine = %q, want MergeTree", tbl.Engine)
+				}
+				if tbl.OrderBy != "ts" {
+					t.Errorf("OrderBy = %q, want ts", tbl.OrderBy)
+				}
+			},
+		},
+		{
+			name: "nested parens in types and codecs",
+			sql: `CREATE TABLE t (
+				attrs Map(String, Array(Tuple(String, UInt64))) CODEC(ZSTD(3)),
+				ts DateTime64(3, 'UTC') CODEC(Delta(8), ZSTD(1)),
+				INDEX idx_msg message TYPE tokenbf_v1(32768, 3, 0) GRANULARITY 4
+			) ENGINE = ReplicatedMergeTree('/clickhouse/{shard}/t', '{replica}') ORDER BY (ts, cityHash64(attrs))`,
+			check: func(t *testing.T, tbl *Table) {
+				if len(tbl.Columns) != 2 {
+					t.Fatalf("Columns = %d, want 2", len(tbl.Columns))
+				}
+				if c := tbl.Column("attrs"); c == nil || c.Type != "Map(String, Array(Tuple(String, UInt64)))" || c.Codec != "ZSTD(3)" {
+					t.Errorf("attrs = %+v", c)
+				}
+				if c := tbl.Column("ts"); c == nil || c.Type != "DateTime64(3, 'UTC')" || c.Codec != "Delta(8), ZSTD(1)" {
+					t.Errorf("ts = %+v", c)
+				}
+				if idx := tbl.Index("idx_msg"); idx == nil || idx.Type != "tokenbf_v1(32768, 3, 0)" || idx.Granularity != 4 {
+					t.Errorf("idx_msg = %+v", idx)
+				}
+				if tbl.Engine != "ReplicatedMergeTree('/clickhouse/{shard}/t', '{replica}')" {
+					t.Errorf("Engine = %q", tbl.Engine)
+				}
+				if tbl.OrderBy != "(ts, cityHash64(attrs))" {
+					t.Errorf("OrderBy = %q", tbl.OrderBy)
+				}
+			},
+		},
+		{
+			name: "comments",
+			sql: `-- таблица логов
+				CREATE TABLE t (
+					id UInt64, -- идентификатор, с запятой
+					/* ORDER BY внутри комментария */ msg String COMMENT 'текст -- не комментарий'
+				) ENGINE = MergeTree ORDER BY id`,
+			check: func(t *testing.T, tbl *Table) {
+				if len(tbl.Columns) != 2 {
+					t.Fatalf("Columns = %d, want 2", len(tbl.Columns))
+				}
+				if c := tbl.Column("msg"); c == nil || c.Type != "String" || c.Comment != "текст -- не комментарий" {
+					t.Errorf("msg = %+v", c)
+				}
+				if tbl.OrderBy != "id" {
+					t.Errorf("OrderBy = %q, want id", tbl.OrderBy)
+				}
+			},
+		},
+		{
+			name: "settings",
+			sql:  "CREATE TABLE t (id UInt64) ENGINE = MergeTree ORDER BY id TTL toDate(ts) + INTERVAL 30 DAY SETTINGS index_granularity = 8192, storage_policy = 'hot_cold'",
+			check: func(t *testing.T, tbl *Table) {
+				if got := tbl.Settings["index_granularity"]; got != "8192" {
+					t.Errorf("index_granularity = %q, want 8192", got)
+				}
+				if got := tbl.Settings["storage_policy"]; got != "hot_cold" {
+					t.Errorf("storage_policy = %q, want hot_cold", got)
+				}
+				if tbl.TTL != "toDate(ts) + INTERVAL 30 DAY" {
+					t.Errorf("TTL = %q", tbl.TTL)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tbl, err := ParseCreateTable(tt.sql)
+			if err != nil {
+				t.Fatalf("ParseCreateTable: %v", err)
+			}
+			tt.check(t, tbl)
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"toDate (ts)", "toDate(ts)"},
+		{"cityHash64( `user_id` )", "cityHash64(user_id)"},
+		{"(ts,  service)", "ts, service"},
+		{"tuple ( a , b )", "tuple(a, b)"},
+		{"concat('a  b', x)", "concat('a  b', x)"},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCodecsEqual(t *testing.T) {
+	tests := []struct {
+		live, ref string
+		want      bool
+	}{
+		{"ZSTD(1)", "ZSTD", true},
+		{"ZSTD(1)", "ZSTD(1)", true},
+		{"ZSTD(3)", "ZSTD", false},
+		{"ZSTD(1)", "ZSTD(3)", false},
+		{"CODEC(Delta(8), ZSTD(1))", "Delta, ZSTD", true},
+		{"Delta(4), ZSTD(1)", "Delta(8), ZSTD(1)", false},
+		{"LZ4HC(9)", "LZ4HC", true},
+		{"LZ4", "ZSTD", false},
+		{"Delta(8)", "Delta(8), ZSTD(1)", false},
+	}
+	for _, tt := range tests {
+		if got := CodecsEqual(tt.live, tt.ref); got != tt.want {
+			t.Errorf("CodecsEqual(%q, %q) = %v, want %v", tt.live, tt.ref, got, tt.want)
+		}
+	}
+}
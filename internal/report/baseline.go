@@ -0,0 +1,144 @@
+// Package report — сравнение прогона с baseline-отчётом (report.json предыдущего запуска) и поиск регрессий.
+package report
+
+import (
+	"fmt"
+
+	"clicktester/internal/tests"
+)
+
+// Метрики, по которым ищутся регрессии.
+const (
+	MetricGranules    = "granules"
+	MetricReadRows    = "read_rows"
+	MetricReadBytes   = "read_bytes"
+	MetricMemoryUsage = "memory_usage"
+	MetricDurationMs  = "duration_ms"
+)
+
+// RegressionMetrics — все метрики сравнения с baseline в порядке вывода.
+var RegressionMetrics = []string{MetricGranules, MetricReadRows, MetricReadBytes, MetricMemoryUsage, MetricDurationMs}
+
+// DefaultRegressionPercent — допустимый рост метрики, если пороги не заданы.
+const DefaultRegressionPercent = 20
+
+// Threshold — допустимый рост метрики. Заданные пороги должны быть превышены оба:
+// Percent отсекает относительный шум, Absolute — рост малых значений (например, 2 → 4 мс).
+type Threshold struct {
+	Percent  float64 // рост в процентах от baseline (0 — не проверяется)
+	Absolute float64 // рост в единицах метрики (0 — не проверяется)
+}
+
+// RegressionThresholds — пороги регрессии: общий и переопределения по метрикам.
+type RegressionThresholds struct {
+	Default Threshold
+	Metrics map[string]Threshold
+}
+
+// threshold возвращает порог для метрики.
+func (t RegressionThresholds) threshold(metric string) Threshold {
+	if th, ok := t.Metrics[metric]; ok {
+		return th
+	}
+	if t.Default.Percent == 0 && t.Default.Absolute == 0 {
+		return Threshold{Percent: DefaultRegressionPercent}
+	}
+	return t.Default
+}
+
+// ApplyBaseline сравнивает результаты запросов с baseline по имени шаблона и заполняет Regressions.
+// Сравниваются только успешные в обоих прогонах задачи типа query; задачи, которых нет в baseline, пропускаются.
+// Возвращает число задач с регрессиями.
+func ApplyBaseline(r *tests.RunResult, base *ExportData, th RegressionThresholds) int {
+	byName := make(map[string]tests.TestResult, len(base.Results))
+	for _, b := range base.Results {
+		if b.Type == tests.TaskTypeQuery {
+			byName[b.Name] = b
+		}
+	}
+	regressed := 0
+	for i := range r.Results {
+		cur := &r.Results[i]
+		b, ok := byName[cur.Name]
+		if !ok || cur.Type != tests.TaskTypeQuery || !cur.Pass || !b.Pass {
+			continue
+		}
+		cur.Regressions = compareMetrics(b, *cur, th)
+		if len(cur.Regressions) > 0 {
+			regressed++
+		}
+	}
+	return regressed
+}
+
+// compareMetrics возвращает метрики cur, выросшие относительно base сверх порога.
+func compareMetrics(base, cur tests.TestResult, th RegressionThresholds) []tests.Regression {
+	var out []tests.Regression
+	for _, m := range RegressionMetrics {
+		b, c := metricValue(base, m), metricValue(cur, m)
+		delta := c - b
+		if delta <= 0 {
+			continue
+		}
+		t := th.threshold(m)
+		reg := tests.Regression{Metric: m, Baseline: b, Current: c, Delta: delta}
+		if b > 0 {
+			reg.DeltaPct = delta * 100 / b
+		}
+		if t.Percent > 0 {
+			// при нулевом baseline процент не определён — решает только абсолютный порог
+			if b == 0 && t.Absolute == 0 {
+				continue
+			}
+			if b > 0 && reg.DeltaPct <= t.Percent {
+				continue
+			}
+		}
+		if t.Absolute > 0 && delta <= t.Absolute {
+			continue
+		}
+		out = append(out, reg)
+	}
+	return out
+}
+
+func metricValue(r tests.TestResult, metric string) float64 {
+	switch metric {
+	case MetricGranules:
+		return float64(r.Granules)
+	case MetricReadRows:
+		return float64(r.ReadRows)
+	case MetricReadBytes:
+		return float64(r.ReadBytes)
+	case MetricMemoryUsage:
+		return float64(r.MemoryUsage)
+	case MetricDurationMs:
+		return r.DurationMs
+	}
+	return 0
+}
+
+// ValidateRegressionMetric проверяет имя метрики в report.regression.metrics.
+func ValidateRegressionMetric(name string) error {
+	for _, m := range RegressionMetrics {
+		if m == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown regression metric %q (want one of %v)", name, RegressionMetrics)
+}
+
+// FormatRegression — краткая запись регрессии для консоли и отчёта, например "duration_ms: 12.00 → 18.40 (+53.3%)".
+func FormatRegression(reg tests.Regression) string {
+	if reg.DeltaPct > 0 {
+		return fmt.Sprintf("%s: %s → %s (+%.1f%%)", reg.Metric, formatMetric(reg.Metric, reg.Baseline), formatMetric(reg.Metric, reg.Current), reg.DeltaPct)
+	}
+	return fmt.Sprintf("%s: %s → %s (+%s)", reg.Metric, formatMetric(reg.Metric, reg.Baseline), formatMetric(reg.Metric, reg.Current), formatMetric(reg.Metric, reg.Delta))
+}
+
+func formatMetric(metric string, v float64) string {
+	if metric == MetricDurationMs {
+		return fmt.Sprintf("%.2f", v)
+	}
+	return fmt.Sprintf("%.0f", v)
+}
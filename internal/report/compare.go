@@ -0,0 +1,196 @@
+// Package report — отчёт A/B-сравнения таблиц (HTML и JSON): результаты шаблона на A и B рядом, победитель и ускорение.
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+
+	"clicktester/internal/tests"
+)
+
+// ComparisonExport — данные JSON-экспорта A/B-сравнения.
+type ComparisonExport struct {
+	Meta ReportMeta `json:"meta"`
+	tests.ComparisonResult
+}
+
+// comparisonRow — строка таблицы A/B-отчёта (значения уже отформатированы).
+type comparisonRow struct {
+	Name      string
+	StatusA   string
+	StatusB   string
+	DurationA string
+	DurationB string
+	SpeedUp   string
+	Granules  string
+	ReadRows  string
+	ReadMB    string
+	Memory    string
+	Winner    string // имя таблицы-победителя, "tie" или "—"
+	WinnerCls string // a, b, tie
+	ErrorA    string
+	ErrorB    string
+	QueryA    string
+	QueryB    string
+}
+
+// WriteComparisonJSON записывает результат A/B-сравнения в JSON.
+func WriteComparisonJSON(outputPath string, r *tests.ComparisonResult, meta *ReportMeta) error {
+	if meta == nil {
+		meta = &ReportMeta{}
+	}
+	raw, err := json.MarshalIndent(ComparisonExport{Meta: *meta, ComparisonResult: *r}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath, raw, 0644)
+}
+
+// WriteComparisonHTML записывает результат A/B-сравнения в HTML: по строке на шаблон, A и B рядом.
+// Статусы ok/warn/fail считаются по тем же порогам, что и в основном отчёте.
+func WriteComparisonHTML(outputPath string, r *tests.ComparisonResult, meta *ReportMeta) error {
+	if meta == nil {
+		meta = &ReportMeta{}
+	}
+	if meta.GeneratedAt == "" {
+		meta.GeneratedAt = time.Now().Format("2006-01-02 15:04:05")
+	}
+	rows := make([]comparisonRow, 0, len(r.Pairs))
+	for _, p := range r.Pairs {
+		row := comparisonRow{
+			Name:      p.Name,
+			StatusA:   rowStatus(p.A, meta),
+			StatusB:   rowStatus(p.B, meta),
+			DurationA: fmt.Sprintf("%.2f", p.A.DurationMs),
+			DurationB: fmt.Sprintf("%.2f", p.B.DurationMs),
+			SpeedUp:   "—",
+			Granules:  pairValues(float64(p.A.Granules), float64(p.B.Granules), p.GranulesReductionPct, "%.0f"),
+			ReadRows:  pairValues(float64(p.A.ReadRows), float64(p.B.ReadRows), p.ReadRowsReductionPct, "%.0f"),
+			ReadMB:    pairValues(float64(p.A.ReadBytes)/(1024*1024), float64(p.B.ReadBytes)/(1024*1024), p.ReadBytesReductionPct, "%.2f"),
+			Memory:    pairValues(float64(p.A.MemoryUsage)/(1024*1024), float64(p.B.MemoryUsage)/(1024*1024), p.MemoryReductionPct, "%.2f"),
+			Winner:    "—",
+			WinnerCls: p.Winner,
+			ErrorA:    p.A.Error,
+			ErrorB:    p.B.Error,
+			QueryA:    p.A.Query,
+			QueryB:    p.B.Query,
+		}
+		if p.SpeedUp > 0 {
+			row.SpeedUp = fmt.Sprintf("×%.2f", p.SpeedUp)
+		}
+		switch p.Winner {
+		case "a":
+			row.Winner = r.TableA
+		case "b":
+			row.Winner = r.TableB
+		case "tie":
+			row.Winner = "tie"
+		}
+		rows = append(rows, row)
+	}
+
+	data := struct {
+		Meta ReportMeta
+		*tests.ComparisonResult
+		Rows []comparisonRow
+	}{Meta: *meta, ComparisonResult: r, Rows: rows}
+
+	tmpl := template.Must(template.New("compare").Funcs(funcMap).Parse(comparisonTemplate))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath, buf.Bytes(), 0644)
+}
+
+// pairValues форматирует значения A и B со снижением у B, например "1200 → 300 (−75.0%)".
+func pairValues(a, b, reductionPct float64, format string) string {
+	s := fmt.Sprintf(format+" → "+format, a, b)
+	if reductionPct != 0 {
+		s += fmt.Sprintf(" (%+.1f%%)", -reductionPct)
+	}
+	return s
+}
+
+const comparisonTemplate = `<!DOCTYPE html>
+<html lang="ru">
+<head>
+  <meta charset="UTF-8">
+  <title>ClickTester A/B Comparison</title>
+  <style>
+    body { font-family: system-ui, sans-serif; margin: 1rem 2rem; background: #f5f5f5; }
+    h1 { color: #222; }
+    .meta { color: #666; font-size: 0.9rem; margin-bottom: 1rem; }
+    .summary { margin: 1rem 0; padding: 1rem; background: #fff; border-radius: 8px; box-shadow: 0 1px 3px rgba(0,0,0,0.08); }
+    .summary span { margin-right: 1.5rem; }
+    table { border-collapse: collapse; width: 100%; background: #fff; box-shadow: 0 1px 3px rgba(0,0,0,0.08); border-radius: 8px; overflow: hidden; }
+    th, td { padding: 0.5rem 0.75rem; text-align: left; border-bottom: 1px solid #eee; vertical-align: top; }
+    th { background: #374151; color: #fff; font-weight: 600; }
+    tr:hover { background: #f9fafb; }
+    .status-ok { color: #059669; font-weight: 600; }
+    .status-warn { color: #d97706; font-weight: 600; }
+    .status-fail { color: #dc2626; font-weight: 600; }
+    .winner-a { color: #2563eb; font-weight: 600; }
+    .winner-b { color: #7c3aed; font-weight: 600; }
+    .winner-tie { color: #6b7280; font-weight: 600; }
+    .error { color: #dc2626; font-size: 0.85rem; max-width: 30em; }
+    details pre { margin: 0.25rem 0; font-size: 0.75rem; white-space: pre-wrap; word-break: break-all; background: #f9fafb; padding: 0.5rem; border-radius: 4px; max-height: 12em; overflow: auto; }
+  </style>
+</head>
+<body>
+  <h1>ClickTester A/B Comparison</h1>
+  <div class="meta">
+    Generated: {{ safe .Meta.GeneratedAt }}
+    {{ if .Meta.Host }} | Host: {{ safe .Meta.Host }}{{ end }}
+    | A: <span class="winner-a">{{ safe .TableA }}</span> | B: <span class="winner-b">{{ safe .TableB }}</span>
+  </div>
+  {{ range .Meta.Warnings }}<div class="error">Warning: {{ safe . }}</div>{{ end }}
+  <div class="summary">
+    <span><strong>Templates:</strong> {{ len .Pairs }}</span>
+    <span><strong>{{ safe .TableA }} wins:</strong> <span class="winner-a">{{ .WinsA }}</span></span>
+    <span><strong>{{ safe .TableB }} wins:</strong> <span class="winner-b">{{ .WinsB }}</span></span>
+    <span><strong>Ties:</strong> <span class="winner-tie">{{ .Ties }}</span></span>
+  </div>
+  <table>
+    <thead>
+      <tr>
+        <th>Name</th>
+        <th>Status A / B</th>
+        <th>Duration A (ms)</th>
+        <th>Duration B (ms)</th>
+        <th>Speed-up</th>
+        <th>Granules A → B</th>
+        <th>Read Rows A → B</th>
+        <th>Read MB A → B</th>
+        <th>Memory MB A → B</th>
+        <th>Winner</th>
+      </tr>
+    </thead>
+    <tbody>
+      {{ range .Rows }}
+      <tr>
+        <td>{{ safe .Name }}
+          <details><summary>SQL</summary><pre>{{ safe .QueryA }}</pre><pre>{{ safe .QueryB }}</pre></details>
+          {{ if .ErrorA }}<div class="error">A: {{ safe .ErrorA }}</div>{{ end }}
+          {{ if .ErrorB }}<div class="error">B: {{ safe .ErrorB }}</div>{{ end }}
+        </td>
+        <td><span class="status-{{ .StatusA }}">{{ .StatusA }}</span> / <span class="status-{{ .StatusB }}">{{ .StatusB }}</span></td>
+        <td>{{ .DurationA }}</td>
+        <td>{{ .DurationB }}</td>
+        <td>{{ .SpeedUp }}</td>
+        <td>{{ .Granules }}</td>
+        <td>{{ .ReadRows }}</td>
+        <td>{{ .ReadMB }}</td>
+        <td>{{ .Memory }}</td>
+        <td>{{ if .WinnerCls }}<span class="winner-{{ .WinnerCls }}">{{ safe .Winner }}</span>{{ else }}—{{ end }}</td>
+      </tr>
+      {{ end }}
+    </tbody>
+  </table>
+</body>
+</html>
+`
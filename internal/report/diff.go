@@ -0,0 +1,351 @@
+// Package report — сравнение двух JSON-отчётов (команда diff): дельты метрик, смена статусов, воронка индексов.
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"clicktester/internal/tests"
+)
+
+// Виды изменения задачи между отчётами.
+const (
+	DiffAdded     = "added"
+	DiffRemoved   = "removed"
+	DiffChanged   = "changed"
+	DiffUnchanged = "unchanged"
+)
+
+// DiffReport — результат сравнения двух отчётов: Old — исходный (например, app_logs_v10), New — сравниваемый.
+type DiffReport struct {
+	GeneratedAt string     `json:"generated_at"`
+	Old         DiffSide   `json:"old"`
+	New         DiffSide   `json:"new"`
+	Tasks       []TaskDiff `json:"tasks"`
+	Added       int        `json:"added"`
+	Removed     int        `json:"removed"`
+	Changed     int        `json:"changed"` // задачи со сменой статуса
+}
+
+// DiffSide — сведения об одном из сравниваемых отчётов.
+type DiffSide struct {
+	Path   string     `json:"path"`
+	Meta   ReportMeta `json:"meta"`
+	Total  int        `json:"total"`
+	Passed int        `json:"passed"`
+	Failed int        `json:"failed"`
+}
+
+// TaskDiff — сравнение одной задачи (сопоставление по типу и имени).
+type TaskDiff struct {
+	Name      string         `json:"name"`
+	Type      tests.TaskType `json:"type"`
+	Change    string         `json:"change"`               // added, removed, changed (смена статуса), unchanged
+	OldStatus string         `json:"old_status,omitempty"` // ok / warn / fail по порогам своего отчёта
+	NewStatus string         `json:"new_status,omitempty"`
+	OldError  string         `json:"old_error,omitempty"`
+	NewError  string         `json:"new_error,omitempty"`
+	Metrics   []MetricDelta  `json:"metrics,omitempty"`
+	Funnel    []FunnelDelta  `json:"funnel,omitempty"`
+}
+
+// MetricDelta — изменение метрики (granules, read_rows, read_bytes, memory_usage, duration_ms).
+type MetricDelta struct {
+	Metric   string  `json:"metric"`
+	Old      float64 `json:"old"`
+	New      float64 `json:"new"`
+	Delta    float64 `json:"delta"`
+	DeltaPct float64 `json:"delta_pct,omitempty"` // 0, если старое значение нулевое
+}
+
+// FunnelDelta — стадия воронки отсечения в обоих отчётах (nil — стадии нет в отчёте).
+type FunnelDelta struct {
+	Stage string            `json:"stage"`
+	Name  string            `json:"name,omitempty"`
+	Old   *tests.IndexStage `json:"old,omitempty"`
+	New   *tests.IndexStage `json:"new,omitempty"`
+}
+
+// Diff сравнивает отчёты: задачи сопоставляются по типу и имени, статусы считаются по порогам каждого отчёта.
+func Diff(oldPath string, old *ExportData, newPath string, cur *ExportData) *DiffReport {
+	d := &DiffReport{
+		GeneratedAt: time.Now().Format("2006-01-02 15:04:05"),
+		Old:         DiffSide{Path: oldPath, Meta: old.Meta, Total: old.Total, Passed: old.Passed, Failed: old.Failed},
+		New:         DiffSide{Path: newPath, Meta: cur.Meta, Total: cur.Total, Passed: cur.Passed, Failed: cur.Failed},
+	}
+	key := func(r tests.TestResult) string { return string(r.Type) + "\x00" + r.Name }
+	oldByKey := make(map[string]tests.TestResult, len(old.Results))
+	for _, r := range old.Results {
+		oldByKey[key(r)] = r
+	}
+	seen := make(map[string]bool, len(cur.Results))
+
+	for _, n := range cur.Results {
+		k := key(n)
+		seen[k] = true
+		td := TaskDiff{Name: n.Name, Type: n.Type, NewStatus: rowStatus(n, &cur.Meta), NewError: n.Error}
+		o, ok := oldByKey[k]
+		if !ok {
+			td.Change = DiffAdded
+			d.Added++
+			d.Tasks = append(d.Tasks, td)
+			continue
+		}
+		td.OldStatus = rowStatus(o, &old.Meta)
+		td.OldError = o.Error
+		td.Change = DiffUnchanged
+		if td.OldStatus != td.NewStatus {
+			td.Change = DiffChanged
+			d.Changed++
+		}
+		if n.Type == tests.TaskTypeQuery {
+			td.Metrics = metricDeltas(o, n)
+			td.Funnel = funnelDeltas(o.IndexFunnel, n.IndexFunnel)
+		}
+		d.Tasks = append(d.Tasks, td)
+	}
+	for _, o := range old.Results {
+		if seen[key(o)] {
+			continue
+		}
+		d.Removed++
+		d.Tasks = append(d.Tasks, TaskDiff{Name: o.Name, Type: o.Type, Change: DiffRemoved, OldStatus: rowStatus(o, &old.Meta), OldError: o.Error})
+	}
+
+	// сначала смена статуса, затем добавленные и удалённые, затем остальные (внутри группы — порядок отчёта)
+	rank := map[string]int{DiffChanged: 0, DiffAdded: 1, DiffRemoved: 2, DiffUnchanged: 3}
+	sort.SliceStable(d.Tasks, func(i, j int) bool { return rank[d.Tasks[i].Change] < rank[d.Tasks[j].Change] })
+	return d
+}
+
+func metricDeltas(o, n tests.TestResult) []MetricDelta {
+	out := make([]MetricDelta, 0, len(RegressionMetrics))
+	for _, m := range RegressionMetrics {
+		md := MetricDelta{Metric: m, Old: metricValue(o, m), New: metricValue(n, m)}
+		md.Delta = md.New - md.Old
+		if md.Old != 0 {
+			md.DeltaPct = md.Delta * 100 / md.Old
+		}
+		out = append(out, md)
+	}
+	return out
+}
+
+// funnelDeltas сопоставляет стадии воронки по типу стадии и имени индекса (таблицы в отчётах могут различаться).
+func funnelDeltas(o, n []tests.IndexStage) []FunnelDelta {
+	if len(o) == 0 && len(n) == 0 {
+		return nil
+	}
+	var out []FunnelDelta
+	index := make(map[string]int)
+	stageKey := func(st tests.IndexStage) string { return st.Stage + "\x00" + st.Name }
+	for i := range o {
+		st := o[i]
+		index[stageKey(st)] = len(out)
+		out = append(out, FunnelDelta{Stage: st.Stage, Name: st.Name, Old: &st})
+	}
+	for i := range n {
+		st := n[i]
+		if j, ok := index[stageKey(st)]; ok && out[j].New == nil {
+			out[j].New = &st
+			continue
+		}
+		out = append(out, FunnelDelta{Stage: st.Stage, Name: st.Name, New: &st})
+	}
+	return out
+}
+
+// WriteDiffJSON записывает сравнение в JSON.
+func WriteDiffJSON(outputPath string, d *DiffReport) error {
+	raw, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutput(outputPath, raw)
+}
+
+// WriteDiffMarkdown записывает сравнение в Markdown (например, для комментария к merge request).
+func WriteDiffMarkdown(outputPath string, d *DiffReport) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# ClickTester report diff\n\n")
+	fmt.Fprintf(&b, "| | Report | Table | Total | Passed | Failed |\n|---|---|---|---|---|---|\n")
+	fmt.Fprintf(&b, "| old | %s | %s | %d | %d | %d |\n", mdEscape(d.Old.Path), mdEscape(d.Old.Meta.Table), d.Old.Total, d.Old.Passed, d.Old.Failed)
+	fmt.Fprintf(&b, "| new | %s | %s | %d | %d | %d |\n\n", mdEscape(d.New.Path), mdEscape(d.New.Meta.Table), d.New.Total, d.New.Passed, d.New.Failed)
+	fmt.Fprintf(&b, "Status changes: %d, added: %d, removed: %d\n\n", d.Changed, d.Added, d.Removed)
+
+	fmt.Fprintf(&b, "| Task | Type | Change | Status | Granules | Read rows | Read bytes | Memory | Duration (ms) |\n")
+	fmt.Fprintf(&b, "|---|---|---|---|---|---|---|---|---|\n")
+	for _, t := range d.Tasks {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |", mdEscape(t.Name), t.Type, t.Change, statusChange(t))
+		if len(t.Metrics) == 0 {
+			b.WriteString(" | | | | |\n")
+			continue
+		}
+		for _, m := range t.Metrics {
+			fmt.Fprintf(&b, " %s |", formatDelta(m))
+		}
+		b.WriteString("\n")
+	}
+
+	for _, t := range d.Tasks {
+		if len(t.Funnel) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n### %s — index funnel\n\n| Stage | Index | Granules old | Granules new |\n|---|---|---|---|\n", mdEscape(t.Name))
+		for _, f := range t.Funnel {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", f.Stage, orDash(mdEscape(f.Name)), funnelGranules(f.Old), funnelGranules(f.New))
+		}
+	}
+	return writeOutput(outputPath, []byte(b.String()))
+}
+
+// WriteDiffHTML записывает сравнение в HTML в стиле основного отчёта.
+func WriteDiffHTML(outputPath string, d *DiffReport) error {
+	tmpl := template.Must(template.New("diff").Funcs(funcMap).Funcs(template.FuncMap{
+		"delta":          formatDelta,
+		"statusChange":   statusChange,
+		"funnelGranules": funnelGranules,
+		"deltaClass": func(m MetricDelta) string {
+			switch {
+			case m.Delta > 0:
+				return "worse"
+			case m.Delta < 0:
+				return "better"
+			}
+			return ""
+		},
+	}).Parse(diffTemplate))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, d); err != nil {
+		return err
+	}
+	return writeOutput(outputPath, buf.Bytes())
+}
+
+// writeOutput пишет в файл или в stdout при пути "-".
+func writeOutput(path string, data []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func formatDelta(m MetricDelta) string {
+	if m.Delta == 0 {
+		return formatMetric(m.Metric, m.New)
+	}
+	s := fmt.Sprintf("%s → %s", formatMetric(m.Metric, m.Old), formatMetric(m.Metric, m.New))
+	if m.DeltaPct != 0 {
+		s += fmt.Sprintf(" (%+.1f%%)", m.DeltaPct)
+	}
+	return s
+}
+
+func statusChange(t TaskDiff) string {
+	switch t.Change {
+	case DiffAdded:
+		return "— → " + t.NewStatus
+	case DiffRemoved:
+		return t.OldStatus + " → —"
+	case DiffChanged:
+		return t.OldStatus + " → " + t.NewStatus
+	}
+	return t.NewStatus
+}
+
+func funnelGranules(st *tests.IndexStage) string {
+	if st == nil {
+		return "—"
+	}
+	return fmt.Sprintf("%d/%d", st.GranulesAfter, st.GranulesBefore)
+}
+
+func mdEscape(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "—"
+	}
+	return s
+}
+
+const diffTemplate = `<!DOCTYPE html>
+<html lang="ru">
+<head>
+  <meta charset="UTF-8">
+  <title>ClickTester Report Diff</title>
+  <style>
+    body { font-family: system-ui, sans-serif; margin: 1rem 2rem; background: #f5f5f5; }
+    h1 { color: #222; }
+    h2 { color: #374151; font-size: 1.1rem; margin-top: 1.5rem; }
+    .meta { color: #666; font-size: 0.9rem; margin-bottom: 1rem; }
+    .summary { margin: 1rem 0; padding: 1rem; background: #fff; border-radius: 8px; box-shadow: 0 1px 3px rgba(0,0,0,0.08); }
+    .summary span { margin-right: 1.5rem; }
+    table { border-collapse: collapse; width: 100%; background: #fff; box-shadow: 0 1px 3px rgba(0,0,0,0.08); border-radius: 8px; overflow: hidden; }
+    th, td { padding: 0.5rem 0.75rem; text-align: left; border-bottom: 1px solid #eee; }
+    th { background: #374151; color: #fff; font-weight: 600; }
+    tr:hover { background: #f9fafb; }
+    .change-changed { color: #d97706; font-weight: 600; }
+    .change-added { color: #2563eb; font-weight: 600; }
+    .change-removed { color: #6b7280; font-weight: 600; }
+    .worse { color: #dc2626; }
+    .better { color: #059669; }
+    .error { color: #dc2626; font-size: 0.85rem; max-width: 40em; }
+    .funnel { width: auto; margin-top: 0.5rem; font-size: 0.8125rem; }
+  </style>
+</head>
+<body>
+  <h1>ClickTester Report Diff</h1>
+  <div class="meta">Generated: {{ safe .GeneratedAt }}</div>
+  <table>
+    <thead><tr><th></th><th>Report</th><th>Generated</th><th>Host</th><th>Table</th><th>Total</th><th>Passed</th><th>Failed</th></tr></thead>
+    <tbody>
+      <tr><td>old</td><td>{{ safe .Old.Path }}</td><td>{{ safe .Old.Meta.GeneratedAt }}</td><td>{{ safe .Old.Meta.Host }}</td><td>{{ safe .Old.Meta.Database }}.{{ safe .Old.Meta.Table }}</td><td>{{ .Old.Total }}</td><td>{{ .Old.Passed }}</td><td>{{ .Old.Failed }}</td></tr>
+      <tr><td>new</td><td>{{ safe .New.Path }}</td><td>{{ safe .New.Meta.GeneratedAt }}</td><td>{{ safe .New.Meta.Host }}</td><td>{{ safe .New.Meta.Database }}.{{ safe .New.Meta.Table }}</td><td>{{ .New.Total }}</td><td>{{ .New.Passed }}</td><td>{{ .New.Failed }}</td></tr>
+    </tbody>
+  </table>
+  <div class="summary">
+    <span><strong>Status changes:</strong> <span class="change-changed">{{ .Changed }}</span></span>
+    <span><strong>Added:</strong> <span class="change-added">{{ .Added }}</span></span>
+    <span><strong>Removed:</strong> <span class="change-removed">{{ .Removed }}</span></span>
+  </div>
+  <table>
+    <thead>
+      <tr><th>Task</th><th>Type</th><th>Change</th><th>Status</th><th>Granules</th><th>Read Rows</th><th>Read Bytes</th><th>Memory</th><th>Duration (ms)</th><th>Error</th></tr>
+    </thead>
+    <tbody>
+      {{ range .Tasks }}
+      <tr>
+        <td>{{ safe .Name }}</td>
+        <td>{{ safe .Type }}</td>
+        <td><span class="change-{{ .Change }}">{{ .Change }}</span></td>
+        <td>{{ statusChange . }}</td>
+        {{ if .Metrics }}{{ range .Metrics }}<td class="{{ deltaClass . }}">{{ delta . }}</td>{{ end }}{{ else }}<td>—</td><td>—</td><td>—</td><td>—</td><td>—</td>{{ end }}
+        <td>{{ if .NewError }}<span class="error">{{ safe .NewError }}</span>{{ else if .OldError }}<span class="error">было: {{ safe .OldError }}</span>{{ end }}</td>
+      </tr>
+      {{ end }}
+    </tbody>
+  </table>
+  {{ range .Tasks }}{{ if .Funnel }}
+  <h2>{{ safe .Name }} — воронка индексов</h2>
+  <table class="funnel">
+    <thead><tr><th>Stage</th><th>Index</th><th>Granules old</th><th>Granules new</th></tr></thead>
+    <tbody>
+      {{ range .Funnel }}
+      <tr><td>{{ safe .Stage }}</td><td>{{ if .Name }}{{ safe .Name }}{{ else }}—{{ end }}</td><td>{{ funnelGranules .Old }}</td><td>{{ funnelGranules .New }}</td></tr>
+      {{ end }}
+    </tbody>
+  </table>
+  {{ end }}{{ end }}
+</body>
+</html>
+`
@@ -5,7 +5,9 @@ import (
 	"bytes"
 	"fmt"
 	"html"
+	"io"
 	"os"
+	"sort"
 	"strings"
 	"text/template"
 	"time"
@@ -20,9 +22,12 @@ type ReportMeta struct {
 	Database     string `json:"database,omitempty"`
 	Table        string `json:"table,omitempty"`
 	Workers      int    `json:"workers"`
+	Baseline     string `json:"baseline,omitempty"` // путь к baseline-отчёту (-baseline)
 	GranulesWarn int    `json:"granules_warn"`
 	GranulesFail int    `json:"granules_fail"`
 	ReadRowsWarn int    `json:"read_rows_warn"`
+	// Warnings — проблемы прогона вне отдельных тестов (например, KILL QUERY при отмене не прошёл).
+	Warnings []string `json:"warnings,omitempty"`
 }
 
 // rowView — одна строка таблицы с вычисленным статусом (все поля — примитивы для шаблона).
@@ -34,17 +39,58 @@ type rowView struct {
 	TypeStr         string
 	Status          string
 	Error           string
+	Failures        []string // невыполненные ожидания шаблона (assertions)
 	Granules        int
 	ReadRows        uint64
 	ReadMB          string
 	MemoryUsage     string // отображаемое значение memory_usage (байты → MB или "—")
 	Duration        string
+	ServerDuration  string // query_duration_ms из query_log или "—"
 	RowsReturned    int
 	ProjectionUsed  bool
+	ProjectionKnown bool // есть данные query_log (иначе в колонке «—»)
+	Projections     []string
 	ExplainText     string
 	QueryID          string
 	Partitions       []string
 	PartitionDetails []tests.PartitionInfo
+	IndexFunnel      []funnelView
+	ProfileEvents    []profileEventView
+	ResultTable      *tests.ResultTable
+	Iterations       int
+	Warmup           int
+	Stats            []statView // сводка по замерам (iterations > 1)
+	ColdDuration     string     // время после сброса кэшей (cache_mode cold/both) или "—"
+	WarmDuration     string     // время на прогретых кэшах (cache_mode both) или "—"
+	CacheWarnings    []string
+	Regressions      []string // регрессии относительно baseline (FormatRegression)
+}
+
+// statView — строка сводки по повторным замерам одной метрики.
+type statView struct {
+	Metric string
+	Min    string
+	Median string
+	P95    string
+	Max    string
+	Stddev string
+}
+
+// profileEventView — одно значение ProfileEvents (отсортированы по имени).
+type profileEventView struct {
+	Name  string
+	Value uint64
+}
+
+// funnelView — строка воронки отсечения по индексам (EXPLAIN indexes=1).
+type funnelView struct {
+	Table     string
+	Stage     string
+	Name      string
+	IndexType string
+	Parts     string // "после/до"
+	Granules  string // "после/до"
+	Pruned    string // доля гранул, отсечённых на этой стадии
 }
 
 // reportData — данные для шаблона.
@@ -54,11 +100,28 @@ type reportData struct {
 	Passed int
 	Failed int
 	Rows   []rowView
+	// Cancelled — задачи, не выполненные из-за отмены прогона.
+	Cancelled int
+	// ShowCache — есть результаты в режиме cache_mode cold/both: выводятся колонки Cold и Warm.
+	ShowCache bool
+	// ShowBaseline — прогон сравнивался с baseline: выводится колонка регрессий.
+	ShowBaseline bool
+	Regressed    int // задач с регрессиями
+	Colspan      int // число колонок таблицы (для раскрываемой строки)
 }
 
 // WriteHTML записывает RunResult в HTML-файл по пути outputPath.
 // meta может быть nil — тогда заголовок без конфига; пороги для warn/fail берутся из meta.
 func WriteHTML(outputPath string, r *tests.RunResult, meta *ReportMeta) error {
+	var buf bytes.Buffer
+	if err := RenderHTML(&buf, r, meta); err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath, buf.Bytes(), 0644)
+}
+
+// RenderHTML пишет HTML-отчёт в w (например, в ответ сервера -serve для прогона из истории).
+func RenderHTML(w io.Writer, r *tests.RunResult, meta *ReportMeta) error {
 	if meta == nil {
 		meta = &ReportMeta{GeneratedAt: time.Now().Format("2006-01-02 15:04:05")}
 	}
@@ -76,14 +139,35 @@ func WriteHTML(outputPath string, r *tests.RunResult, meta *ReportMeta) error {
 			TypeStr:          string(res.Type),
 			Status:           rowStatus(res, meta),
 			Error:            res.Error,
+			Failures:         res.AssertionFailures,
 			Granules:         res.Granules,
 			ReadRows:         res.ReadRows,
 			RowsReturned:     res.RowsReturned,
 			ProjectionUsed:   res.ProjectionUsed,
+			ProjectionKnown:  res.ProjectionSource == tests.ProjectionSourceQueryLog,
+			Projections:      res.Projections,
 			ExplainText:      res.ExplainText,
 			QueryID:          res.QueryID,
 			Partitions:       res.Partitions,
 			PartitionDetails: res.PartitionDetails,
+			IndexFunnel:      buildFunnelViews(res.IndexFunnel),
+			ProfileEvents:    buildProfileEventViews(res.ProfileEvents),
+			ResultTable:      res.ResultTable,
+			Iterations:       res.Iterations,
+			Warmup:           res.Warmup,
+			Stats:            buildStatViews(res),
+			ColdDuration:     "—",
+			WarmDuration:     "—",
+			CacheWarnings:    res.CacheWarnings,
+		}
+		for _, reg := range res.Regressions {
+			rv.Regressions = append(rv.Regressions, FormatRegression(reg))
+		}
+		if res.ColdDurationMs > 0 {
+			rv.ColdDuration = fmt.Sprintf("%.2f", res.ColdDurationMs)
+		}
+		if res.WarmDurationMs > 0 {
+			rv.WarmDuration = fmt.Sprintf("%.2f", res.WarmDurationMs)
 		}
 		if res.ReadBytes > 0 {
 			rv.ReadMB = fmt.Sprintf("%.2f", float64(res.ReadBytes)/(1024*1024))
@@ -104,6 +188,11 @@ func WriteHTML(outputPath string, r *tests.RunResult, meta *ReportMeta) error {
 		} else {
 			rv.Duration = "—"
 		}
+		if res.ServerDurationMs > 0 {
+			rv.ServerDuration = fmt.Sprintf("%d", res.ServerDurationMs)
+		} else {
+			rv.ServerDuration = "—"
+		}
 		rows = append(rows, rv)
 	}
 
@@ -114,27 +203,101 @@ func WriteHTML(outputPath string, r *tests.RunResult, meta *ReportMeta) error {
 		Failed: r.Failed,
 		Rows:   rows,
 	}
+	data.Cancelled = r.Cancelled
+	data.ShowBaseline = meta.Baseline != ""
+	for _, res := range r.Results {
+		if res.CacheMode == tests.CacheModeCold || res.CacheMode == tests.CacheModeBoth {
+			data.ShowCache = true
+		}
+		if len(res.Regressions) > 0 {
+			data.Regressed++
+		}
+	}
+	data.Colspan = 14
+	if data.ShowCache {
+		data.Colspan += 2
+	}
+	if data.ShowBaseline {
+		data.Colspan++
+	}
 
 	tmpl := template.Must(template.New("report").Funcs(funcMap).Parse(reportTemplate))
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		return err
+	return tmpl.Execute(w, data)
+}
+
+// buildStatViews форматирует сводку замеров: длительность в мс, строки как есть, память в MB.
+func buildStatViews(res tests.TestResult) []statView {
+	var out []statView
+	add := func(metric string, m *tests.MetricSummary, format func(float64) string) {
+		if m == nil {
+			return
+		}
+		out = append(out, statView{
+			Metric: metric,
+			Min:    format(m.Min),
+			Median: format(m.Median),
+			P95:    format(m.P95),
+			Max:    format(m.Max),
+			Stddev: format(m.Stddev),
+		})
 	}
-	return os.WriteFile(outputPath, buf.Bytes(), 0644)
+	add("Duration (ms)", res.DurationStats, func(v float64) string { return fmt.Sprintf("%.2f", v) })
+	add("Cold duration (ms)", res.ColdDurationStats, func(v float64) string { return fmt.Sprintf("%.2f", v) })
+	add("Read Rows", res.ReadRowsStats, func(v float64) string { return fmt.Sprintf("%.0f", v) })
+	add("Memory (MB)", res.MemoryStats, func(v float64) string { return fmt.Sprintf("%.2f", v/(1024*1024)) })
+	return out
+}
+
+func buildFunnelViews(stages []tests.IndexStage) []funnelView {
+	if len(stages) == 0 {
+		return nil
+	}
+	out := make([]funnelView, 0, len(stages))
+	for _, st := range stages {
+		fv := funnelView{
+			Table:     st.Table,
+			Stage:     st.Stage,
+			Name:      st.Name,
+			IndexType: st.IndexType,
+			Parts:     fmt.Sprintf("%d/%d", st.PartsAfter, st.PartsBefore),
+			Granules:  fmt.Sprintf("%d/%d", st.GranulesAfter, st.GranulesBefore),
+			Pruned:    "—",
+		}
+		if st.GranulesBefore > 0 {
+			fv.Pruned = fmt.Sprintf("%.1f%%", float64(st.GranulesBefore-st.GranulesAfter)*100/float64(st.GranulesBefore))
+		}
+		out = append(out, fv)
+	}
+	return out
+}
+
+func buildProfileEventViews(events map[string]uint64) []profileEventView {
+	if len(events) == 0 {
+		return nil
+	}
+	out := make([]profileEventView, 0, len(events))
+	for name, v := range events {
+		out = append(out, profileEventView{Name: name, Value: v})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
 }
 
 func rowStatus(res tests.TestResult, meta *ReportMeta) string {
+	if res.Cancelled {
+		return StatusCancelled
+	}
 	if !res.Pass {
-		return "fail"
+		return StatusFail
 	}
 	if meta.GranulesFail > 0 && res.Granules >= meta.GranulesFail {
-		return "fail"
+		return StatusFail
 	}
 	if (meta.GranulesWarn > 0 && res.Granules >= meta.GranulesWarn) ||
 		(meta.ReadRowsWarn > 0 && int(res.ReadRows) >= meta.ReadRowsWarn) {
-		return "warn"
+		return StatusWarn
 	}
-	return "ok"
+	return StatusOK
 }
 
 var funcMap = template.FuncMap{
@@ -174,7 +337,9 @@ const reportTemplate = `<!DOCTYPE html>
     .status-ok { color: #059669; font-weight: 600; }
     .status-warn { color: #d97706; font-weight: 600; }
     .status-fail { color: #dc2626; font-weight: 600; }
+    .status-cancelled { color: #64748b; font-weight: 600; }
     .error { color: #dc2626; font-size: 0.85rem; max-width: 40em; }
+    .assertions { margin: 0; padding-left: 1.1rem; }
     .explain { font-size: 0.8rem; white-space: pre-wrap; max-height: 8em; overflow: auto; background: #f9fafb; padding: 0.5rem; border-radius: 4px; }
     .expand-btn { background: none; border: none; cursor: pointer; padding: 0.25rem; color: #6b7280; font-size: 0.75rem; }
     .expand-btn:hover { color: #111; }
@@ -186,6 +351,9 @@ const reportTemplate = `<!DOCTYPE html>
     .detail-cell .parts-table { margin-top: 0.25rem; font-size: 0.8125rem; border-collapse: collapse; }
     .detail-cell .parts-table th, .detail-cell .parts-table td { padding: 0.25rem 0.5rem; border: 1px solid #e5e7eb; }
     .detail-cell .parts-table th { background: #f3f4f6; }
+    .result-table summary { cursor: pointer; }
+    .detail-cell .parts-table pre.cell { margin: 0; padding: 0; border: none; background: none; max-height: 8em; font-size: 0.75rem; }
+    .col-type { font-weight: normal; color: #6b7280; font-size: 0.75rem; }
     .query-id-hint { margin: 0.25rem 0 0 0; font-size: 0.8rem; color: #6b7280; }
     .query-id-hint code { background: #f3f4f6; padding: 0.1rem 0.3rem; border-radius: 3px; }
   </style>
@@ -198,11 +366,15 @@ const reportTemplate = `<!DOCTYPE html>
     {{ if .Meta.Database }} | Database: {{ safe .Meta.Database }}{{ end }}
     {{ if .Meta.Table }} | Table: {{ safe .Meta.Table }}{{ end }}
     {{ if .Meta.Workers }} | Workers: {{ .Meta.Workers }}{{ end }}
+    {{ if .Meta.Baseline }} | Baseline: {{ safe .Meta.Baseline }}{{ end }}
   </div>
+  {{ range .Meta.Warnings }}<div class="error">Warning: {{ safe . }}</div>{{ end }}
   <div class="summary">
     <span><strong>Total:</strong> {{ .Total }}</span>
     <span><strong>Passed:</strong> <span class="status-ok">{{ .Passed }}</span></span>
     <span><strong>Failed:</strong> <span class="status-fail">{{ .Failed }}</span></span>
+    {{ if .Cancelled }}<span><strong>Cancelled:</strong> <span class="status-cancelled">{{ .Cancelled }}</span></span>{{ end }}
+    {{ if .ShowBaseline }}<span><strong>Regressions:</strong> <span class="{{ if .Regressed }}status-fail{{ else }}status-ok{{ end }}">{{ .Regressed }}</span></span>{{ end }}
   </div>
   <table>
     <thead>
@@ -218,7 +390,11 @@ const reportTemplate = `<!DOCTYPE html>
         <th>Read MB</th>
         <th>Memory (MB)</th>
         <th>Duration (ms)</th>
+        {{ if .ShowCache }}<th>Cold (ms)</th>
+        <th>Warm (ms)</th>{{ end }}
+        <th>Server (ms)</th>
         <th>Rows</th>
+        {{ if .ShowBaseline }}<th>vs Baseline</th>{{ end }}
         <th>Error / Details</th>
       </tr>
     </thead>
@@ -230,23 +406,42 @@ const reportTemplate = `<!DOCTYPE html>
         <td>{{ safe .Name }}</td>
         <td>{{ safe .TypeStr }}</td>
         <td><span class="status-{{ .Status }}">{{ .Status }}</span></td>
-        <td>{{ if eq .TypeStr "query" }}{{ if .ProjectionUsed }}yes{{ else }}no{{ end }}{{ else }}—{{ end }}</td>
+        <td>{{ if eq .TypeStr "query" }}{{ if .Projections }}{{ range $i, $p := .Projections }}{{ if $i }}, {{ end }}{{ safe $p }}{{ end }}{{ else if .ProjectionUsed }}yes{{ else if .ProjectionKnown }}no{{ else }}—{{ end }}{{ else }}—{{ end }}</td>
         <td>{{ if eq .TypeStr "query" }}{{ .Granules }}{{ else }}—{{ end }}</td>
         <td>{{ if eq .TypeStr "query" }}{{ .ReadRows }}{{ else }}—{{ end }}</td>
         <td>{{ .ReadMB }}</td>
         <td>{{ .MemoryUsage }}</td>
-        <td>{{ .Duration }}</td>
-        <td>{{ if eq .TypeStr "query" }}{{ .RowsReturned }}{{ else }}—{{ end }}</td>
+        <td{{ if .Stats }} title="медиана из {{ .Iterations }} замеров"{{ end }}>{{ .Duration }}{{ if .Stats }} <span class="col-type">med</span>{{ end }}</td>
+        {{ if $.ShowCache }}<td>{{ .ColdDuration }}</td>
+        <td>{{ .WarmDuration }}</td>{{ end }}
+        <td>{{ .ServerDuration }}</td>
+        <td>{{ if or (eq .TypeStr "query") .ResultTable }}{{ .RowsReturned }}{{ else }}—{{ end }}</td>
+        {{ if $.ShowBaseline }}<td>{{ if .Regressions }}<ul class="error assertions">{{ range .Regressions }}<li>{{ safe . }}</li>{{ end }}</ul>{{ else }}—{{ end }}</td>{{ end }}
         <td>
-          {{ if .Error }}<span class="error">{{ safe .Error }}</span>{{ end }}
+          {{ if .Failures }}<ul class="error assertions">{{ range .Failures }}<li>{{ safe . }}</li>{{ end }}</ul>{{ else if .Error }}<span class="error">{{ safe .Error }}</span>{{ end }}
           {{ if and (not .Error) .ExplainText }}<details><summary>EXPLAIN</summary><div class="explain">{{ safe .ExplainText }}</div></details>{{ end }}
         </td>
       </tr>
       <tr class="detail-row" data-task-id="{{ .TaskID }}">
-        <td colspan="12" class="detail-cell">
+        <td colspan="{{ $.Colspan }}" class="detail-cell">
           {{ if .QueryID }}<div class="label">Query ID</div><div><code>{{ safe .QueryID }}</code></div><p class="query-id-hint">Для поиска в БД: <code>SELECT * FROM system.query_log WHERE query_id = '{{ safe .QueryID }}'</code></p>{{ end }}
           {{ if .Description }}<div class="label" {{ if .QueryID }}style="margin-top:0.75rem"{{ end }}>Описание</div><div>{{ safe .Description }}</div>{{ end }}
           {{ if .Query }}{{ if or .QueryID .Description }}<div class="label" style="margin-top:0.75rem">SQL</div>{{ else }}<div class="label">SQL</div>{{ end }}<pre>{{ safe .Query }}</pre>{{ end }}
+          {{ if .CacheWarnings }}
+          <div class="label" style="margin-top:0.75rem">Кэши не сброшены</div>
+          <ul class="error">{{ range .CacheWarnings }}<li>{{ safe . }}</li>{{ end }}</ul>
+          {{ end }}
+          {{ if .Stats }}
+          <div class="label" style="margin-top:0.75rem">Замеры ({{ .Iterations }} итераций{{ if .Warmup }}, прогрев {{ .Warmup }}{{ end }})</div>
+          <table class="parts-table">
+            <thead><tr><th>Metric</th><th>Min</th><th>Median</th><th>p95</th><th>Max</th><th>Stddev</th></tr></thead>
+            <tbody>
+            {{ range .Stats }}
+            <tr><td>{{ .Metric }}</td><td>{{ .Min }}</td><td>{{ .Median }}</td><td>{{ .P95 }}</td><td>{{ .Max }}</td><td>{{ .Stddev }}</td></tr>
+            {{ end }}
+            </tbody>
+          </table>
+          {{ end }}
           {{ if .PartitionDetails }}
           <div class="label" style="margin-top:0.75rem">Партиции</div>
           <table class="parts-table">
@@ -261,7 +456,43 @@ const reportTemplate = `<!DOCTYPE html>
           <div class="label" style="margin-top:0.75rem">Партиции (query_log)</div>
           <div>{{ range .Partitions }}{{ safe . }} {{ end }}</div>
           {{ end }}
-          {{ if and (not .QueryID) (not .Description) (not .Query) (not .PartitionDetails) (not .Partitions) }}—{{ end }}
+          {{ if .IndexFunnel }}
+          <div class="label" style="margin-top:0.75rem">Воронка индексов (EXPLAIN indexes=1)</div>
+          <table class="parts-table">
+            <thead><tr><th>Table</th><th>Stage</th><th>Index</th><th>Type</th><th>Parts</th><th>Granules</th><th>Pruned</th></tr></thead>
+            <tbody>
+            {{ range .IndexFunnel }}
+            <tr><td>{{ safe .Table }}</td><td>{{ safe .Stage }}</td><td>{{ if .Name }}{{ safe .Name }}{{ else }}—{{ end }}</td><td>{{ if .IndexType }}{{ safe .IndexType }}{{ else }}—{{ end }}</td><td>{{ .Parts }}</td><td>{{ .Granules }}</td><td>{{ .Pruned }}</td></tr>
+            {{ end }}
+            </tbody>
+          </table>
+          {{ end }}
+          {{ with .ResultTable }}
+          <details class="result-table" style="margin-top:0.75rem">
+            <summary class="label">Результат ({{ .TotalRows }} стр.{{ if gt .TotalRows (len .Rows) }}, показаны первые {{ len .Rows }}{{ end }})</summary>
+            {{ $types := .Types }}
+            <table class="parts-table">
+              <thead><tr>{{ range $i, $c := .Columns }}<th>{{ safe $c }}<br><span class="col-type">{{ safe (index $types $i) }}</span></th>{{ end }}</tr></thead>
+              <tbody>
+              {{ range .Rows }}
+              <tr>{{ range . }}<td><pre class="cell">{{ safe . }}</pre></td>{{ end }}</tr>
+              {{ end }}
+              </tbody>
+            </table>
+          </details>
+          {{ end }}
+          {{ if .ProfileEvents }}
+          <div class="label" style="margin-top:0.75rem">ProfileEvents</div>
+          <table class="parts-table">
+            <thead><tr><th>Event</th><th>Value</th></tr></thead>
+            <tbody>
+            {{ range .ProfileEvents }}
+            <tr><td>{{ safe .Name }}</td><td>{{ .Value }}</td></tr>
+            {{ end }}
+            </tbody>
+          </table>
+          {{ end }}
+          {{ if and (not .QueryID) (not .Description) (not .Query) (not .PartitionDetails) (not .Partitions) (not .IndexFunnel) (not .ProfileEvents) (not .ResultTable) }}—{{ end }}
         </td>
       </tr>
       {{ end }}
@@ -3,6 +3,7 @@ package report
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 
 	"clicktester/internal/tests"
@@ -10,11 +11,12 @@ import (
 
 // ExportData — данные для JSON-экспорта (мета + результаты с полями запроса: name, description, query и т.д.).
 type ExportData struct {
-	Meta    ReportMeta        `json:"meta"`
-	Total   int               `json:"total"`
-	Passed  int               `json:"passed"`
-	Failed  int               `json:"failed"`
-	Results []tests.TestResult `json:"results"`
+	Meta      ReportMeta         `json:"meta"`
+	Total     int                `json:"total"`
+	Passed    int                `json:"passed"`
+	Failed    int                `json:"failed"`
+	Cancelled int                `json:"cancelled,omitempty"`
+	Results   []tests.TestResult `json:"results"`
 }
 
 // WriteJSON записывает результат прогона и метаданные в JSON по пути outputPath.
@@ -24,11 +26,12 @@ func WriteJSON(outputPath string, r *tests.RunResult, meta *ReportMeta) error {
 		meta = &ReportMeta{}
 	}
 	data := ExportData{
-		Meta:    *meta,
-		Total:   r.Total,
-		Passed:  r.Passed,
-		Failed:  r.Failed,
-		Results: r.Results,
+		Meta:      *meta,
+		Total:     r.Total,
+		Passed:    r.Passed,
+		Failed:    r.Failed,
+		Cancelled: r.Cancelled,
+		Results:   r.Results,
 	}
 	raw, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
@@ -36,3 +39,27 @@ func WriteJSON(outputPath string, r *tests.RunResult, meta *ReportMeta) error {
 	}
 	return os.WriteFile(outputPath, raw, 0644)
 }
+
+// ReadJSON читает ранее записанный WriteJSON отчёт (например, для -baseline).
+func ReadJSON(path string) (*ExportData, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read report: %w", err)
+	}
+	var data ExportData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("parse report %s: %w", path, err)
+	}
+	return &data, nil
+}
+
+// RunResult восстанавливает результат прогона из экспорта (для повторной генерации HTML-отчёта).
+func (d *ExportData) RunResult() *tests.RunResult {
+	return &tests.RunResult{
+		Total:     d.Total,
+		Passed:    d.Passed,
+		Failed:    d.Failed,
+		Cancelled: d.Cancelled,
+		Results:   d.Results,
+	}
+}
@@ -0,0 +1,209 @@
+// Package report — JUnit XML для CI: задача → testcase, структурные проверки и запросы — отдельные testsuite.
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"clicktester/internal/tests"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Errors     int              `xml:"errors,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       string           `xml:"time,attr"`
+	Timestamp  string           `xml:"timestamp,attr,omitempty"`
+	Hostname   string           `xml:"hostname,attr,omitempty"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Cases      []junitTestCase  `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name       string           `xml:"name,attr"`
+	Classname  string           `xml:"classname,attr"`
+	Time       string           `xml:"time,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Failure    *junitProblem    `xml:"failure,omitempty"`
+	Error      *junitProblem    `xml:"error,omitempty"`
+	Skipped    *junitProblem    `xml:"skipped,omitempty"`
+	SystemOut  string           `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitProperties struct {
+	Items []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// WriteJUnit записывает результаты в JUnit XML: testsuite "structure" и "query", testcase на каждую задачу.
+// Ошибка выполнения — <error>; невыполненные ожидания, превышение granules_fail и регрессии — <failure>;
+// задачи, прерванные отменой прогона, — <skipped>; метрики (granules, read_rows, memory_usage, ...) — свойства testcase.
+func WriteJUnit(outputPath string, r *tests.RunResult, meta *ReportMeta) error {
+	if meta == nil {
+		meta = &ReportMeta{}
+	}
+	root := junitTestSuites{Name: "clicktester"}
+	var total float64
+	for _, typ := range []tests.TaskType{tests.TaskTypeStructure, tests.TaskTypeQuery} {
+		suite := junitTestSuite{
+			Name:      string(typ),
+			Timestamp: strings.Replace(meta.GeneratedAt, " ", "T", 1),
+			Hostname:  meta.Host,
+			Properties: nonEmptyProperties(
+				junitProperty{"database", meta.Database},
+				junitProperty{"table", meta.Table},
+				junitProperty{"baseline", meta.Baseline},
+			),
+		}
+		var suiteTime float64
+		for _, res := range r.Results {
+			if res.Type != typ {
+				continue
+			}
+			tc := junitCase(res, meta)
+			suite.Tests++
+			if tc.Failure != nil {
+				suite.Failures++
+			}
+			if tc.Error != nil {
+				suite.Errors++
+			}
+			if tc.Skipped != nil {
+				suite.Skipped++
+			}
+			suiteTime += res.DurationMs / 1000
+			suite.Cases = append(suite.Cases, tc)
+		}
+		if suite.Tests == 0 {
+			continue
+		}
+		suite.Time = formatSeconds(suiteTime)
+		root.Tests += suite.Tests
+		root.Failures += suite.Failures
+		root.Errors += suite.Errors
+		root.Skipped += suite.Skipped
+		total += suiteTime
+		root.Suites = append(root.Suites, suite)
+	}
+	root.Time = formatSeconds(total)
+
+	raw, err := xml.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath, append([]byte(xml.Header), append(raw, '\n')...), 0644)
+}
+
+func junitCase(res tests.TestResult, meta *ReportMeta) junitTestCase {
+	status := rowStatus(res, meta)
+	tc := junitTestCase{
+		Name:      res.Name,
+		Classname: string(res.Type),
+		Time:      formatSeconds(res.DurationMs / 1000),
+		SystemOut: res.Query,
+	}
+	switch {
+	case res.Cancelled:
+		tc.Skipped = &junitProblem{Message: res.Error, Type: "cancelled"}
+	case len(res.AssertionFailures) > 0:
+		tc.Failure = &junitProblem{
+			Message: fmt.Sprintf("%d expectation(s) failed", len(res.AssertionFailures)),
+			Type:    "assertion",
+			Text:    strings.Join(res.AssertionFailures, "\n"),
+		}
+	case !res.Pass:
+		tc.Error = &junitProblem{Message: res.Error, Type: "error", Text: res.Error}
+	case status == StatusFail:
+		msg := fmt.Sprintf("granules %d >= granules_fail %d", res.Granules, meta.GranulesFail)
+		tc.Failure = &junitProblem{Message: msg, Type: "threshold", Text: msg}
+	case len(res.Regressions) > 0:
+		lines := make([]string, 0, len(res.Regressions))
+		for _, reg := range res.Regressions {
+			lines = append(lines, FormatRegression(reg))
+		}
+		tc.Failure = &junitProblem{
+			Message: fmt.Sprintf("%d regression(s) vs baseline", len(res.Regressions)),
+			Type:    "regression",
+			Text:    strings.Join(lines, "\n"),
+		}
+	}
+
+	props := []junitProperty{{"status", status}}
+	if res.QueryID != "" {
+		props = append(props, junitProperty{"query_id", res.QueryID})
+	}
+	if res.Type == tests.TaskTypeQuery {
+		props = append(props,
+			junitProperty{"granules", strconv.Itoa(res.Granules)},
+			junitProperty{"read_rows", strconv.FormatUint(res.ReadRows, 10)},
+			junitProperty{"read_bytes", strconv.FormatUint(res.ReadBytes, 10)},
+			junitProperty{"memory_usage", strconv.FormatUint(res.MemoryUsage, 10)},
+			junitProperty{"duration_ms", fmt.Sprintf("%.2f", res.DurationMs)},
+		)
+		if res.ServerDurationMs > 0 {
+			props = append(props, junitProperty{"server_duration_ms", strconv.FormatUint(res.ServerDurationMs, 10)})
+		}
+		if res.ColdDurationMs > 0 {
+			props = append(props, junitProperty{"cold_duration_ms", fmt.Sprintf("%.2f", res.ColdDurationMs)})
+		}
+		if len(res.Projections) > 0 {
+			props = append(props, junitProperty{"projections", strings.Join(res.Projections, ",")})
+		}
+		names := make([]string, 0, len(res.ProfileEvents))
+		for name := range res.ProfileEvents {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			props = append(props, junitProperty{"profile_event." + name, strconv.FormatUint(res.ProfileEvents[name], 10)})
+		}
+	}
+	props = append(props, junitProperty{"rows_returned", strconv.Itoa(res.RowsReturned)})
+	tc.Properties = &junitProperties{Items: props}
+	return tc
+}
+
+// nonEmptyProperties оставляет свойства с непустым значением (nil — блок properties не выводится).
+func nonEmptyProperties(props ...junitProperty) *junitProperties {
+	var out []junitProperty
+	for _, p := range props {
+		if p.Value != "" {
+			out = append(out, p)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return &junitProperties{Items: out}
+}
+
+func formatSeconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', 3, 64)
+}
@@ -0,0 +1,55 @@
+// Package report — сводка статусов прогона для кода возврата (та же логика ok/warn/fail, что в HTML-отчёте).
+package report
+
+import "clicktester/internal/tests"
+
+// Статусы задачи в отчёте.
+const (
+	StatusOK   = "ok"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+	// StatusCancelled — задача не выполнена: прогон отменён (DELETE /api/runs/{id}, Ctrl+C).
+	StatusCancelled = "cancelled"
+)
+
+// StatusCounts — число задач по статусам отчёта.
+type StatusCounts struct {
+	OK          int
+	Warn        int
+	Fail        int // невыполненные ожидания, expect/ddl_drift, превышение granules_fail
+	Errors      int // ошибки выполнения запроса (в отчёте тоже fail)
+	Cancelled   int // не выполнены из-за отмены прогона
+	Regressions int // задачи с регрессиями относительно baseline
+}
+
+// Status возвращает статус задачи (ok / warn / fail / cancelled) по порогам из meta — как в колонке Status HTML-отчёта.
+func Status(res tests.TestResult, meta *ReportMeta) string {
+	if meta == nil {
+		meta = &ReportMeta{}
+	}
+	return rowStatus(res, meta)
+}
+
+// CountStatuses считает задачи по статусам. Ошибка выполнения (Pass=false без списка нарушенных ожиданий)
+// учитывается в Errors, а не в Fail.
+func CountStatuses(r *tests.RunResult, meta *ReportMeta) StatusCounts {
+	var c StatusCounts
+	for _, res := range r.Results {
+		if len(res.Regressions) > 0 {
+			c.Regressions++
+		}
+		switch {
+		case res.Cancelled:
+			c.Cancelled++
+		case !res.Pass && len(res.AssertionFailures) == 0:
+			c.Errors++
+		case Status(res, meta) == StatusFail:
+			c.Fail++
+		case Status(res, meta) == StatusWarn:
+			c.Warn++
+		default:
+			c.OK++
+		}
+	}
+	return c
+}
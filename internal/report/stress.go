@@ -0,0 +1,571 @@
+// Package report — отчёт стресс-теста (HTML и JSON): параметры, графики задержки и QPS по секундам,
+// гистограмма задержек, разбивка ошибок и серверные метрики из query_log.
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"clicktester/internal/runner"
+)
+
+// StressConfig — параметры стресс-теста в отчёте.
+type StressConfig struct {
+	Mode            string              `json:"mode"`            // closed или open
+	QueryName       string              `json:"query,omitempty"` // шаблон (без смеси)
+	Queries         []StressConfigQuery `json:"queries,omitempty"`
+	Workers         int                 `json:"workers,omitempty"`
+	TargetQPS       float64             `json:"target_qps,omitempty"`
+	MaxInFlight     int                 `json:"max_in_flight,omitempty"`
+	DurationSec     float64             `json:"duration_sec"` // заданная длительность (сумма ступеней профиля)
+	QueryTimeoutSec float64             `json:"query_timeout_sec,omitempty"`
+	Stages          []StressConfigStage `json:"stages,omitempty"`
+}
+
+// StressConfigQuery — шаблон смеси с весом.
+type StressConfigQuery struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+}
+
+// StressConfigStage — ступень профиля нагрузки.
+type StressConfigStage struct {
+	DurationSec float64 `json:"duration_sec"`
+	Workers     int     `json:"workers,omitempty"`
+	TargetQPS   float64 `json:"target_qps,omitempty"`
+	Ramp        bool    `json:"ramp,omitempty"`
+}
+
+// NewStressConfig описывает параметры стресс-теста: queryName — шаблон (если не задана смесь opts.Queries),
+// duration — заданная длительность теста.
+func NewStressConfig(queryName string, opts runner.StressOptions, duration time.Duration) StressConfig {
+	c := StressConfig{
+		Mode:            runner.StressModeClosed,
+		QueryName:       queryName,
+		Workers:         opts.Workers,
+		TargetQPS:       opts.TargetQPS,
+		MaxInFlight:     opts.MaxInFlight,
+		DurationSec:     duration.Seconds(),
+		QueryTimeoutSec: opts.QueryTimeout.Seconds(),
+	}
+	open := opts.TargetQPS > 0
+	for _, s := range opts.Stages {
+		c.Stages = append(c.Stages, StressConfigStage{DurationSec: s.Duration.Seconds(), Workers: s.Workers, TargetQPS: s.TargetQPS, Ramp: s.Ramp})
+		open = open || s.TargetQPS > 0
+	}
+	if len(opts.Stages) > 0 {
+		c.Workers, c.TargetQPS = 0, 0
+	}
+	if open {
+		c.Mode = runner.StressModeOpen
+		if len(opts.Stages) == 0 {
+			c.Workers = 0
+		}
+	} else {
+		c.MaxInFlight = 0
+	}
+	if len(opts.Queries) > 0 {
+		c.QueryName = ""
+		for _, q := range opts.Queries {
+			c.Queries = append(c.Queries, StressConfigQuery{Name: q.Name, Weight: q.Weight})
+		}
+	}
+	return c
+}
+
+// StressExport — данные JSON-отчёта стресс-теста.
+type StressExport struct {
+	Meta   ReportMeta           `json:"meta"`
+	Config StressConfig         `json:"config"`
+	Result *runner.StressResult `json:"result"` // сводка, ряд по секундам, гистограмма, серверные метрики
+}
+
+// WriteStressJSON записывает результат стресс-теста в JSON.
+func WriteStressJSON(outputPath string, cfg StressConfig, r *runner.StressResult, meta *ReportMeta) error {
+	if meta == nil {
+		meta = &ReportMeta{}
+	}
+	raw, err := json.MarshalIndent(StressExport{Meta: *meta, Config: cfg, Result: r}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath, raw, 0644)
+}
+
+// WriteStressHTML записывает результат стресс-теста в HTML-файл.
+func WriteStressHTML(outputPath string, cfg StressConfig, r *runner.StressResult, meta *ReportMeta) error {
+	var buf bytes.Buffer
+	if err := RenderStressHTML(&buf, cfg, r, meta); err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath, buf.Bytes(), 0644)
+}
+
+// RenderStressHTML пишет HTML-отчёт стресс-теста в w. Графики — встроенный SVG, отчёт открывается без сети.
+func RenderStressHTML(w io.Writer, cfg StressConfig, r *runner.StressResult, meta *ReportMeta) error {
+	if meta == nil {
+		meta = &ReportMeta{}
+	}
+	if meta.GeneratedAt == "" {
+		meta.GeneratedAt = time.Now().Format("2006-01-02 15:04:05")
+	}
+	data := struct {
+		Meta          ReportMeta
+		Config        StressConfig
+		Result        *runner.StressResult
+		Load          string // цель нагрузки одной строкой
+		LatencyChart  string
+		QPSChart      string
+		HistChart     string
+		ProfileEvents []profileEventView
+	}{
+		Meta:      *meta,
+		Config:    cfg,
+		Result:    r,
+		Load:      stressLoad(cfg),
+		HistChart: histogramSVG(r.Histogram, r.LatencyP50Ms, r.LatencyP95Ms, r.LatencyP99Ms),
+	}
+	data.LatencyChart, data.QPSChart = stressCharts(r)
+	if r.Server != nil {
+		data.ProfileEvents = buildProfileEventViews(r.Server.ProfileEvents)
+	}
+	tmpl := template.Must(template.New("stress").Funcs(funcMap).Funcs(template.FuncMap{
+		"mb":  func(v uint64) string { return fmt.Sprintf("%.2f", float64(v)/(1024*1024)) },
+		"mbf": func(v float64) string { return fmt.Sprintf("%.2f", v/(1024*1024)) },
+		"pct": func(n, total int) string {
+			if total == 0 {
+				return "—"
+			}
+			return fmt.Sprintf("%.1f%%", float64(n)*100/float64(total))
+		},
+	}).Parse(stressTemplate))
+	return tmpl.Execute(w, data)
+}
+
+// stressLoad — цель нагрузки: воркеры, частота или число ступеней профиля.
+func stressLoad(cfg StressConfig) string {
+	switch {
+	case len(cfg.Stages) > 0:
+		return fmt.Sprintf("%d stages", len(cfg.Stages))
+	case cfg.Mode == runner.StressModeOpen:
+		return fmt.Sprintf("%g QPS, max in flight %d", cfg.TargetQPS, cfg.MaxInFlight)
+	default:
+		return fmt.Sprintf("%d workers", cfg.Workers)
+	}
+}
+
+// stressCharts строит графики задержки и пропускной способности по секундам; начала ступеней — пунктиром.
+func stressCharts(r *runner.StressResult) (latency, qps string) {
+	if len(r.Intervals) == 0 {
+		return "", ""
+	}
+	xs := make([]float64, len(r.Intervals))
+	p50 := chartSeries{Name: "p50", Color: "#2563eb"}
+	p95 := chartSeries{Name: "p95", Color: "#d97706"}
+	p99 := chartSeries{Name: "p99", Color: "#dc2626"}
+	pmax := chartSeries{Name: "max", Color: "#9ca3af"}
+	rate := chartSeries{Name: "QPS", Color: "#059669"}
+	target := chartSeries{Name: "target QPS", Color: "#6b7280", Dashed: true}
+	errs := chartSeries{Name: "errors/s", Color: "#dc2626"}
+	dropped := chartSeries{Name: "dropped/s", Color: "#7c3aed"}
+	var hasErrors, hasDropped bool
+	for i, iv := range r.Intervals {
+		xs[i] = float64(iv.Second)
+		p50.Values = append(p50.Values, iv.LatencyP50Ms)
+		p95.Values = append(p95.Values, iv.LatencyP95Ms)
+		p99.Values = append(p99.Values, iv.LatencyP99Ms)
+		pmax.Values = append(pmax.Values, iv.LatencyMaxMs)
+		rate.Values = append(rate.Values, iv.QPS)
+		target.Values = append(target.Values, iv.TargetQPS)
+		errs.Values = append(errs.Values, float64(iv.Errors))
+		dropped.Values = append(dropped.Values, float64(iv.Dropped))
+		hasErrors = hasErrors || iv.Errors > 0
+		hasDropped = hasDropped || iv.Dropped > 0
+	}
+	var marks []float64
+	for _, st := range r.Stages[min(1, len(r.Stages)):] {
+		marks = append(marks, st.StartSec)
+	}
+	throughput := []chartSeries{rate}
+	if r.Mode == runner.StressModeOpen {
+		throughput = append(throughput, target)
+	}
+	if hasErrors {
+		throughput = append(throughput, errs)
+	}
+	if hasDropped {
+		throughput = append(throughput, dropped)
+	}
+	return lineChartSVG(xs, []chartSeries{pmax, p99, p95, p50}, marks, "ms"),
+		lineChartSVG(xs, throughput, marks, "req/s")
+}
+
+// Размеры графиков в единицах viewBox (на странице SVG растягивается по ширине).
+const (
+	chartWidth  = 900
+	chartHeight = 260
+	chartLeft   = 60 // место под подписи оси Y
+	chartRight  = 12
+	chartTop    = 16
+	chartBottom = 28 // место под подписи оси X
+	histBins    = 40
+)
+
+// chartSeries — линия графика: значение на каждую точку оси X.
+type chartSeries struct {
+	Name   string
+	Color  string
+	Dashed bool
+	Values []float64
+}
+
+// lineChartSVG рисует линии series по точкам xs (секунды теста) с легендой; marks — вертикальные пунктиры.
+func lineChartSVG(xs []float64, series []chartSeries, marks []float64, unit string) string {
+	if len(xs) == 0 || len(series) == 0 {
+		return ""
+	}
+	xMin, xMax := xs[0], xs[len(xs)-1]
+	if xMax <= xMin {
+		xMax = xMin + 1
+	}
+	yMax := 0.0
+	for _, s := range series {
+		for _, v := range s.Values {
+			yMax = math.Max(yMax, v)
+		}
+	}
+	yTop, yStep := niceScale(yMax)
+	pw, ph := float64(chartWidth-chartLeft-chartRight), float64(chartHeight-chartTop-chartBottom)
+	px := func(x float64) float64 { return chartLeft + (x-xMin)/(xMax-xMin)*pw }
+	py := func(y float64) float64 { return chartTop + ph - y/yTop*ph }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="chart" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg">`, chartWidth, chartHeight)
+	for i := 0; float64(i)*yStep <= yTop+yStep/2; i++ {
+		v := float64(i) * yStep
+		fmt.Fprintf(&b, `<line x1="%d" x2="%d" y1="%.1f" y2="%.1f" class="grid"/>`, chartLeft, chartWidth-chartRight, py(v), py(v))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" class="axis">%s</text>`, chartLeft-6, py(v)+4, axisLabel(v, yStep))
+	}
+	fmt.Fprintf(&b, `<text x="4" y="%d" class="axis">%s</text>`, chartTop-4, unit)
+	xStep := max(niceStep((xMax-xMin)/8), 1) // по секундам
+	for x := math.Ceil(xMin/xStep) * xStep; x <= xMax+xStep/1e6; x += xStep {
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle" class="axis">%ss</text>`, px(x), chartHeight-8, axisLabel(x, xStep))
+	}
+	for _, m := range marks {
+		if m > xMin && m < xMax {
+			fmt.Fprintf(&b, `<line x1="%.1f" x2="%.1f" y1="%d" y2="%.1f" class="mark"/>`, px(m), px(m), chartTop, chartTop+ph)
+		}
+	}
+	for _, s := range series {
+		dash := ""
+		if s.Dashed {
+			dash = ` stroke-dasharray="6 4"`
+		}
+		points := make([]string, 0, len(s.Values))
+		for i, v := range s.Values {
+			points = append(points, fmt.Sprintf("%.1f,%.1f", px(xs[i]), py(v)))
+		}
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="1.5"%s points="%s"/>`, s.Color, dash, strings.Join(points, " "))
+		if len(points) == 1 {
+			fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"/>`, px(xs[0]), py(s.Values[0]), s.Color)
+		}
+	}
+	b.WriteString(`</svg><div class="legend">`)
+	for _, s := range series {
+		fmt.Fprintf(&b, `<span><i style="background:%s"></i>%s</span>`, s.Color, s.Name)
+	}
+	b.WriteString(`</div>`)
+	return b.String()
+}
+
+// histogramSVG рисует гистограмму задержек: корзины раннера сводятся в histBins столбцов на логарифмической шкале,
+// перцентили отмечены вертикальными линиями.
+func histogramSVG(buckets []runner.HistogramBucket, p50, p95, p99 float64) string {
+	if len(buckets) == 0 {
+		return ""
+	}
+	lo := math.Max(buckets[0].FromMs, 0.001)
+	hi := math.Max(buckets[len(buckets)-1].ToMs, lo*1.01)
+	logSpan := math.Log(hi / lo)
+	counts := make([]uint64, histBins)
+	for _, bk := range buckets {
+		mid := math.Max((bk.FromMs+bk.ToMs)/2, lo)
+		i := int(math.Log(mid/lo) / logSpan * histBins)
+		counts[min(max(i, 0), histBins-1)] += bk.Count
+	}
+	var maxCount uint64
+	for _, c := range counts {
+		maxCount = max(maxCount, c)
+	}
+	yTop, yStep := niceScale(float64(maxCount))
+	pw, ph := float64(chartWidth-chartLeft-chartRight), float64(chartHeight-chartTop-chartBottom)
+	px := func(ms float64) float64 { return chartLeft + math.Log(ms/lo)/logSpan*pw }
+	py := func(y float64) float64 { return chartTop + ph - y/yTop*ph }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="chart" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg">`, chartWidth, chartHeight)
+	for i := 0; float64(i)*yStep <= yTop+yStep/2; i++ {
+		v := float64(i) * yStep
+		fmt.Fprintf(&b, `<line x1="%d" x2="%d" y1="%.1f" y2="%.1f" class="grid"/>`, chartLeft, chartWidth-chartRight, py(v), py(v))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" class="axis">%s</text>`, chartLeft-6, py(v)+4, axisLabel(v, yStep))
+	}
+	fmt.Fprintf(&b, `<text x="4" y="%d" class="axis">requests</text>`, chartTop-4)
+	barWidth := pw / histBins
+	for i, c := range counts {
+		from := lo * math.Exp(logSpan*float64(i)/histBins)
+		to := lo * math.Exp(logSpan*float64(i+1)/histBins)
+		if i%(histBins/8) == 0 {
+			fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle" class="axis">%s</text>`, px(from), chartHeight-8, formatMs(from))
+		}
+		if c == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="#60a5fa"><title>%s–%s ms: %d</title></rect>`,
+			px(from)+0.5, py(float64(c)), math.Max(barWidth-1, 1), py(0)-py(float64(c)), formatMs(from), formatMs(to), c)
+	}
+	for _, p := range []struct {
+		name string
+		v    float64
+	}{{"p50", p50}, {"p95", p95}, {"p99", p99}} {
+		if p.v < lo || p.v > hi {
+			continue
+		}
+		fmt.Fprintf(&b, `<line x1="%.1f" x2="%.1f" y1="%d" y2="%.1f" class="mark"/>`, px(p.v), px(p.v), chartTop, chartTop+ph)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" class="axis">%s</text>`, px(p.v)+3, chartTop+10, p.name)
+	}
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+// niceScale подбирает верх оси и шаг делений (1, 2 или 5 × 10^n) примерно на 5 делений.
+func niceScale(maxValue float64) (top, step float64) {
+	if maxValue <= 0 {
+		return 1, 0.2
+	}
+	step = niceStep(maxValue / 5)
+	return math.Ceil(maxValue/step) * step, step
+}
+
+// niceStep округляет шаг вверх до 1, 2 или 5 × 10^n.
+func niceStep(raw float64) float64 {
+	if raw <= 0 {
+		return 1
+	}
+	exp := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5} {
+		if raw <= m*exp {
+			return m * exp
+		}
+	}
+	return 10 * exp
+}
+
+// axisLabel форматирует деление оси с числом знаков после запятой по шагу.
+func axisLabel(v, step float64) string {
+	decimals := max(0, int(-math.Floor(math.Log10(step))))
+	return fmt.Sprintf("%.*f", decimals, v)
+}
+
+// formatMs — подпись задержки на оси гистограммы.
+func formatMs(ms float64) string {
+	switch {
+	case ms >= 1000:
+		return fmt.Sprintf("%.3gs", ms/1000)
+	case ms >= 1:
+		return fmt.Sprintf("%.3g", ms)
+	default:
+		return fmt.Sprintf("%.2g", ms)
+	}
+}
+
+const stressTemplate = `<!DOCTYPE html>
+<html lang="ru">
+<head>
+  <meta charset="UTF-8">
+  <title>ClickTester Stress Test Report</title>
+  <style>
+    body { font-family: system-ui, sans-serif; margin: 1rem 2rem; background: #f5f5f5; }
+    h1 { color: #222; }
+    h2 { color: #222; font-size: 1.15rem; margin: 1.5rem 0 0.5rem; }
+    .meta { color: #666; font-size: 0.9rem; margin-bottom: 1rem; }
+    .summary { margin: 1rem 0; padding: 1rem; background: #fff; border-radius: 8px; box-shadow: 0 1px 3px rgba(0,0,0,0.08); }
+    .summary span { margin-right: 1.5rem; }
+    .panel { padding: 1rem; background: #fff; border-radius: 8px; box-shadow: 0 1px 3px rgba(0,0,0,0.08); }
+    table { border-collapse: collapse; width: 100%; background: #fff; box-shadow: 0 1px 3px rgba(0,0,0,0.08); border-radius: 8px; overflow: hidden; }
+    th, td { padding: 0.5rem 0.75rem; text-align: left; border-bottom: 1px solid #eee; vertical-align: top; }
+    th { background: #374151; color: #fff; font-weight: 600; }
+    tr:hover { background: #f9fafb; }
+    .status-ok { color: #059669; font-weight: 600; }
+    .status-fail { color: #dc2626; font-weight: 600; }
+    .error { color: #dc2626; font-size: 0.85rem; word-break: break-word; }
+    .muted { color: #6b7280; }
+    svg.chart { width: 100%; height: auto; display: block; }
+    svg.chart .grid { stroke: #eee; }
+    svg.chart .mark { stroke: #9ca3af; stroke-dasharray: 3 3; }
+    svg.chart .axis { fill: #6b7280; font-size: 11px; }
+    .legend { font-size: 0.85rem; color: #374151; margin-top: 0.25rem; }
+    .legend span { margin-right: 1rem; }
+    .legend i { display: inline-block; width: 0.8rem; height: 0.8rem; margin-right: 0.3rem; vertical-align: -1px; border-radius: 2px; }
+  </style>
+</head>
+<body>
+  <h1>ClickTester Stress Test Report</h1>
+  <div class="meta">
+    Generated: {{ safe .Meta.GeneratedAt }}
+    {{ if .Meta.Host }} | Host: {{ safe .Meta.Host }}{{ end }}
+    {{ if .Meta.Database }} | Database: {{ safe .Meta.Database }}{{ end }}
+  </div>
+  {{ range .Meta.Warnings }}<div class="error">Warning: {{ safe . }}</div>{{ end }}
+  <div class="summary">
+    <span><strong>Mode:</strong> {{ .Result.Mode }}</span>
+    <span><strong>Load:</strong> {{ safe .Load }}</span>
+    <span><strong>Total:</strong> {{ .Result.Total }}</span>
+    <span><strong>Success:</strong> <span class="status-ok">{{ .Result.Success }}</span></span>
+    <span><strong>Failed:</strong> <span class="{{ if .Result.Failed }}status-fail{{ end }}">{{ .Result.Failed }}</span></span>
+    <span><strong>Cancelled:</strong> {{ .Result.Cancelled }}</span>
+    {{ if eq .Result.Mode "open" }}<span><strong>Dropped:</strong> {{ .Result.Dropped }}</span>
+    <span><strong>Late:</strong> {{ .Result.Late }}</span>{{ end }}
+    <span><strong>Duration:</strong> {{ printf "%.1f" .Result.DurationSec }} s</span>
+    <span><strong>QPS:</strong> {{ printf "%.1f" .Result.QPS }}</span>
+    <br>
+    <span><strong>Latency, ms:</strong> p50 {{ printf "%.1f" .Result.LatencyP50Ms }} | p95 {{ printf "%.1f" .Result.LatencyP95Ms }} | p99 {{ printf "%.1f" .Result.LatencyP99Ms }} | max {{ printf "%.1f" .Result.LatencyMaxMs }} | avg {{ printf "%.1f" .Result.LatencyAvgMs }}</span>
+    {{ if eq .Result.Mode "open" }}<span class="muted">latency measured from the intended start</span>{{ end }}
+  </div>
+
+  <h2>Configuration</h2>
+  <table>
+    <tbody>
+      <tr><th>Mode</th><td>{{ .Config.Mode }}</td></tr>
+      {{ if .Config.QueryName }}<tr><th>Query template</th><td>{{ safe .Config.QueryName }}</td></tr>{{ end }}
+      {{ if .Config.Queries }}<tr><th>Query mix</th><td>{{ range $i, $q := .Config.Queries }}{{ if $i }}, {{ end }}{{ safe $q.Name }} (weight {{ $q.Weight }}){{ end }}</td></tr>{{ end }}
+      {{ if .Config.Workers }}<tr><th>Workers</th><td>{{ .Config.Workers }}</td></tr>{{ end }}
+      {{ if .Config.TargetQPS }}<tr><th>Target QPS</th><td>{{ .Config.TargetQPS }}</td></tr>{{ end }}
+      {{ if .Config.MaxInFlight }}<tr><th>Max in flight</th><td>{{ .Config.MaxInFlight }}</td></tr>{{ end }}
+      {{ if .Config.Stages }}<tr><th>Profile</th><td>{{ range $i, $s := .Config.Stages }}{{ if $i }} → {{ end }}{{ $s.DurationSec }} s at {{ if $s.TargetQPS }}{{ $s.TargetQPS }} QPS{{ else }}{{ $s.Workers }} workers{{ end }}{{ if $s.Ramp }} (ramp){{ end }}{{ end }}</td></tr>{{ end }}
+      <tr><th>Duration</th><td>{{ .Config.DurationSec }} s</td></tr>
+      <tr><th>Query timeout</th><td>{{ if .Config.QueryTimeoutSec }}{{ .Config.QueryTimeoutSec }} s{{ else }}—{{ end }}</td></tr>
+    </tbody>
+  </table>
+
+  {{ if .LatencyChart }}
+  <h2>Latency over time</h2>
+  <div class="panel">{{ .LatencyChart }}</div>
+  <h2>Throughput</h2>
+  <div class="panel">{{ .QPSChart }}</div>
+  {{ end }}
+
+  {{ if .HistChart }}
+  <h2>Latency histogram</h2>
+  <div class="panel">{{ .HistChart }}</div>
+  {{ end }}
+
+  {{ if .Result.Stages }}
+  <h2>Stages</h2>
+  <table>
+    <thead><tr><th>#</th><th>Start (s)</th><th>Target</th><th>Total</th><th>Failed</th><th>Dropped</th><th>QPS</th><th>p50 (ms)</th><th>p95 (ms)</th><th>p99 (ms)</th><th>max (ms)</th></tr></thead>
+    <tbody>
+      {{ range .Result.Stages }}
+      <tr>
+        <td>{{ .Stage }}</td>
+        <td>{{ printf "%.0f" .StartSec }}</td>
+        <td>{{ if .TargetQPS }}{{ .TargetQPS }} QPS{{ else }}{{ .Workers }} workers{{ end }}{{ if .Ramp }} (ramp){{ end }}</td>
+        <td>{{ .Total }}</td>
+        <td>{{ .Failed }}</td>
+        <td>{{ .Dropped }}</td>
+        <td>{{ printf "%.1f" .QPS }}</td>
+        <td>{{ printf "%.1f" .LatencyP50Ms }}</td>
+        <td>{{ printf "%.1f" .LatencyP95Ms }}</td>
+        <td>{{ printf "%.1f" .LatencyP99Ms }}</td>
+        <td>{{ printf "%.1f" .LatencyMaxMs }}</td>
+      </tr>
+      {{ end }}
+    </tbody>
+  </table>
+  {{ end }}
+
+  {{ if .Result.Templates }}
+  <h2>Templates</h2>
+  <table>
+    <thead><tr><th>Name</th><th>Weight</th><th>Total</th><th>Failed</th><th>QPS</th><th>p50 (ms)</th><th>p95 (ms)</th><th>p99 (ms)</th><th>max (ms)</th></tr></thead>
+    <tbody>
+      {{ range .Result.Templates }}
+      <tr>
+        <td>{{ safe .Name }}</td>
+        <td>{{ .Weight }}</td>
+        <td>{{ .Total }}</td>
+        <td>{{ .Failed }}</td>
+        <td>{{ printf "%.1f" .QPS }}</td>
+        <td>{{ printf "%.1f" .LatencyP50Ms }}</td>
+        <td>{{ printf "%.1f" .LatencyP95Ms }}</td>
+        <td>{{ printf "%.1f" .LatencyP99Ms }}</td>
+        <td>{{ printf "%.1f" .LatencyMaxMs }}</td>
+      </tr>
+      {{ end }}
+    </tbody>
+  </table>
+  {{ end }}
+
+  <h2>Errors</h2>
+  {{ if .Result.ErrorBreakdown }}
+  <table>
+    <thead><tr><th>Error</th><th>Count</th><th>Share of failed</th></tr></thead>
+    <tbody>
+      {{ $failed := .Result.Failed }}
+      {{ range .Result.ErrorBreakdown }}
+      <tr><td class="error">{{ safe .Error }}</td><td>{{ .Count }}</td><td>{{ pct .Count $failed }}</td></tr>
+      {{ end }}
+    </tbody>
+  </table>
+  {{ if .Result.ErrorSamples }}
+  <details><summary>Error samples</summary>{{ range .Result.ErrorSamples }}<div class="error">{{ safe . }}</div>{{ end }}</details>
+  {{ end }}
+  {{ else }}
+  <div class="panel muted">No errors.</div>
+  {{ end }}
+
+  <h2>Server-side metrics (system.query_log)</h2>
+  {{ with .Result.Server }}
+  {{ if .Error }}
+  <div class="panel error">Not available: {{ safe .Error }}</div>
+  {{ else }}
+  <table>
+    <tbody>
+      <tr><th>Queries logged</th><td>{{ .Queries }}</td></tr>
+      <tr><th>Exceptions</th><td>{{ .Exceptions }}</td></tr>
+      <tr><th>Server duration, ms</th><td>avg {{ printf "%.1f" .DurationAvgMs }} | p50 {{ printf "%.1f" .DurationP50Ms }} | p95 {{ printf "%.1f" .DurationP95Ms }} | p99 {{ printf "%.1f" .DurationP99Ms }} | max {{ printf "%.1f" .DurationMaxMs }}</td></tr>
+      <tr><th>Read rows</th><td>{{ .ReadRows }}</td></tr>
+      <tr><th>Read MB</th><td>{{ mb .ReadBytes }}</td></tr>
+      <tr><th>Memory MB</th><td>avg {{ mbf .MemoryAvg }} | max {{ mb .MemoryMax }}</td></tr>
+    </tbody>
+  </table>
+  {{ if .TopExceptions }}
+  <h2>Server exceptions</h2>
+  <table>
+    <thead><tr><th>Code</th><th>Name</th><th>Count</th></tr></thead>
+    <tbody>
+      {{ range .TopExceptions }}<tr><td>{{ .Code }}</td><td>{{ safe .Name }}</td><td>{{ .Count }}</td></tr>{{ end }}
+    </tbody>
+  </table>
+  {{ end }}
+  {{ end }}
+  {{ else }}
+  <div class="panel muted">—</div>
+  {{ end }}
+  {{ if .ProfileEvents }}
+  <h2>ProfileEvents (sum)</h2>
+  <table>
+    <tbody>
+      {{ range .ProfileEvents }}<tr><th>{{ safe .Name }}</th><td>{{ .Value }}</td></tr>{{ end }}
+    </tbody>
+  </table>
+  {{ end }}
+</body>
+</html>
+`
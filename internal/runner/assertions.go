@@ -0,0 +1,90 @@
+// Package runner — проверка ожиданий шаблона запроса (max_granules, max_read_rows, expect_projection и т.д.).
+package runner
+
+import (
+	"fmt"
+	"strings"
+
+	"clicktester/internal/tests"
+)
+
+// evaluateAssertions проверяет результат запроса против ожиданий шаблона.
+// Возвращает список невыполненных ожиданий в виде "ключ: факт vs ожидание"; пустой список — всё выполнено.
+func evaluateAssertions(a tests.Assertions, tr *tests.TestResult) []string {
+	var failures []string
+	if a.MaxGranules > 0 && tr.Granules > a.MaxGranules {
+		failures = append(failures, fmt.Sprintf("max_granules: %d > %d", tr.Granules, a.MaxGranules))
+	}
+	if a.MaxReadRows > 0 && tr.ReadRows > a.MaxReadRows {
+		failures = append(failures, fmt.Sprintf("max_read_rows: %d > %d", tr.ReadRows, a.MaxReadRows))
+	}
+	if a.MaxReadBytes > 0 && tr.ReadBytes > a.MaxReadBytes {
+		failures = append(failures, fmt.Sprintf("max_read_bytes: %d > %d", tr.ReadBytes, a.MaxReadBytes))
+	}
+	if a.MaxDurationMs > 0 && tr.DurationMs > a.MaxDurationMs {
+		failures = append(failures, fmt.Sprintf("max_duration_ms: %.2f > %.2f", tr.DurationMs, a.MaxDurationMs))
+	}
+	if a.MinRowsReturned > 0 && tr.RowsReturned < a.MinRowsReturned {
+		failures = append(failures, fmt.Sprintf("min_rows_returned: %d < %d", tr.RowsReturned, a.MinRowsReturned))
+	}
+	if a.ExpectProjection != "" {
+		if msg := checkProjection(a.ExpectProjection, tr); msg != "" {
+			failures = append(failures, msg)
+		}
+	}
+	if a.ExpectIndexUsed != "" {
+		if msg := checkIndexUsed(a.ExpectIndexUsed, tr.IndexFunnel); msg != "" {
+			failures = append(failures, msg)
+		}
+	}
+	return failures
+}
+
+// checkProjection проверяет, что запрос использовал ожидаемую проекцию ("true" — любую).
+// Возвращает пустую строку, если ожидание выполнено, иначе — текст ошибки. Без данных query_log
+// (lookup не удался) ошибка говорит, что использование неизвестно, а не что проекция не использована.
+func checkProjection(expected string, tr *tests.TestResult) string {
+	if tr.ProjectionSource != tests.ProjectionSourceQueryLog {
+		what := "проекция " + expected
+		if strings.EqualFold(expected, "true") {
+			what = "проекция"
+		}
+		return fmt.Sprintf("expect_projection: неизвестно, использована ли %s: нет данных system.query_log", what)
+	}
+	used := tr.Projections
+	usedStr := strings.Join(used, ", ")
+	if usedStr == "" {
+		usedStr = "нет"
+	}
+	if strings.EqualFold(expected, "true") {
+		if len(used) == 0 {
+			return "expect_projection: запрос не использовал проекцию"
+		}
+		return ""
+	}
+	for _, p := range used {
+		if p == expected {
+			return ""
+		}
+	}
+	return fmt.Sprintf("expect_projection: проекция %s не использована (использованы: %s)", expected, usedStr)
+}
+
+// checkIndexUsed проверяет, что индекс (skip-индекс по имени или стадия PrimaryKey/MinMax/Partition)
+// присутствует в воронке EXPLAIN и отсёк хотя бы одну гранулу.
+func checkIndexUsed(expected string, funnel []tests.IndexStage) string {
+	found := false
+	for _, st := range funnel {
+		if st.Name != expected && !(st.Name == "" && strings.EqualFold(st.Stage, expected)) {
+			continue
+		}
+		found = true
+		if st.GranulesAfter < st.GranulesBefore {
+			return ""
+		}
+	}
+	if !found {
+		return fmt.Sprintf("expect_index_used: индекс %s отсутствует в EXPLAIN indexes=1", expected)
+	}
+	return fmt.Sprintf("expect_index_used: индекс %s не отсёк ни одной гранулы", expected)
+}
@@ -0,0 +1,31 @@
+// Package runner — отмена прогона: остановка запросов на сервере ClickHouse.
+package runner
+
+import (
+	"context"
+	"time"
+
+	"clicktester/internal/chclient"
+)
+
+// killTimeout — сколько ждать выполнения KILL QUERY при отмене.
+const killTimeout = 10 * time.Second
+
+// Abort отменяет прогон: запоминает выполняющиеся запросы трекера, отменяет контекст и отправляет
+// KILL QUERY по их query_id. Порядок важен: после отмены запросы снимаются с учёта, а по HTTP
+// соединение пула освобождается только после отмены контекста.
+func Abort(cancel context.CancelFunc, tracker *chclient.QueryTracker, client chclient.Client) error {
+	ids := tracker.Active()
+	cancel()
+	if len(ids) == 0 {
+		return nil
+	}
+	ctx, stop := context.WithTimeout(context.Background(), killTimeout)
+	defer stop()
+	return client.KillQueries(ctx, ids)
+}
+
+// AbortWarning — текст предупреждения в отчёт, если Abort не снял запросы на сервере.
+func AbortWarning(err error) string {
+	return "cancelled queries may still be running on the server: " + err.Error()
+}
@@ -0,0 +1,119 @@
+// Package runner — A/B-сравнение: одни и те же шаблоны на двух таблицах с чередованием порядка запуска.
+package runner
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"clicktester/internal/chclient"
+	"clicktester/internal/tests"
+)
+
+// Победитель пары в A/B-сравнении.
+const (
+	WinnerA   = "a"
+	WinnerB   = "b"
+	WinnerTie = "tie"
+)
+
+// RunComparison выполняет пары задач a[i] и b[i] (один шаблон на двух таблицах) в пуле из workers горутин.
+// Внутри пары запросы идут друг за другом, порядок чередуется (A→B, B→A, ...), чтобы прогрев кэшей
+// и фоновая нагрузка не давали систематического преимущества одной таблице.
+// Разница медиан длительности не больше tiePct процентов считается ничьей.
+func RunComparison(ctx context.Context, a, b []tests.Task, tableA, tableB string, workers int, client chclient.Client, queryTimeout time.Duration, tiePct float64) *tests.ComparisonResult {
+	if workers < 1 {
+		workers = 1
+	}
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	res := &tests.ComparisonResult{
+		TableA: tableA,
+		TableB: tableB,
+		Pairs:  make([]tests.ComparisonPair, n),
+	}
+
+	pairCh := make(chan int, n)
+	for i := 0; i < n; i++ {
+		pairCh <- i
+	}
+	close(pairCh)
+
+	var gate coldGate
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range pairCh {
+				var ra, rb tests.TestResult
+				if i%2 == 0 {
+					ra = gate.runTask(ctx, a[i], client, queryTimeout)
+					rb = gate.runTask(ctx, b[i], client, queryTimeout)
+				} else {
+					rb = gate.runTask(ctx, b[i], client, queryTimeout)
+					ra = gate.runTask(ctx, a[i], client, queryTimeout)
+				}
+				res.Pairs[i] = comparePair(a[i].Name, ra, rb, tiePct)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, p := range res.Pairs {
+		switch p.Winner {
+		case WinnerA:
+			res.WinsA++
+		case WinnerB:
+			res.WinsB++
+		case WinnerTie:
+			res.Ties++
+		}
+	}
+	return res
+}
+
+// comparePair определяет победителя по длительности и считает относительные метрики B к A.
+// Упавший запрос проигрывает; ожидания шаблона (assertions) тоже учитываются через Pass.
+// Пара, где одна из сторон отменена, остаётся без победителя.
+func comparePair(name string, a, b tests.TestResult, tiePct float64) tests.ComparisonPair {
+	p := tests.ComparisonPair{Name: name, A: a, B: b}
+	switch {
+	case !a.Pass && !b.Pass, a.Cancelled || b.Cancelled:
+		return p
+	case !a.Pass:
+		p.Winner = WinnerB
+	case !b.Pass:
+		p.Winner = WinnerA
+	}
+	if a.Pass && b.Pass {
+		p.GranulesReductionPct = reductionPct(float64(a.Granules), float64(b.Granules))
+		p.ReadRowsReductionPct = reductionPct(float64(a.ReadRows), float64(b.ReadRows))
+		p.ReadBytesReductionPct = reductionPct(float64(a.ReadBytes), float64(b.ReadBytes))
+		p.MemoryReductionPct = reductionPct(float64(a.MemoryUsage), float64(b.MemoryUsage))
+		if b.DurationMs > 0 {
+			p.SpeedUp = a.DurationMs / b.DurationMs
+		}
+		slower := math.Max(a.DurationMs, b.DurationMs)
+		switch {
+		case slower == 0 || math.Abs(a.DurationMs-b.DurationMs)*100/slower <= tiePct:
+			p.Winner = WinnerTie
+		case b.DurationMs < a.DurationMs:
+			p.Winner = WinnerB
+		default:
+			p.Winner = WinnerA
+		}
+	}
+	return p
+}
+
+// reductionPct — на сколько процентов b меньше a (0, если a нулевое).
+func reductionPct(a, b float64) float64 {
+	if a == 0 {
+		return 0
+	}
+	return (a - b) * 100 / a
+}
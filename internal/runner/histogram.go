@@ -0,0 +1,121 @@
+// Package runner — гистограмма задержек в стиле HdrHistogram для стресс-теста: память не растёт с числом запросов.
+package runner
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Корзины гистограммы: значения в микросекундах; до histSubBuckets мкс — точные, дальше каждая степень двойки
+// делится на histSubBuckets/2 линейных подкорзин, поэтому относительная погрешность не больше 1/(histSubBuckets/2).
+const (
+	histSubBucketBits = 8
+	histSubBuckets    = 1 << histSubBucketBits // 256: погрешность < 0,8%
+	histHalfBuckets   = histSubBuckets / 2
+	histMaxMicros     = int64(1) << 40 // ~12,7 суток; большие значения попадают в последнюю корзину
+)
+
+// LatencyHistogram — потоковая гистограмма задержек. Нулевое значение готово к использованию.
+// Не потокобезопасна: в стресс-тесте пишет только сборщик метрик.
+type LatencyHistogram struct {
+	counts []uint64 // по индексу корзины; растёт до наибольшего записанного значения
+	total  uint64
+	sumMs  float64
+	minUs  int64
+	maxUs  int64
+}
+
+// HistogramBucket — непустая корзина гистограммы: значения в [FromMs, ToMs).
+type HistogramBucket struct {
+	FromMs float64 `json:"from_ms"`
+	ToMs   float64 `json:"to_ms"`
+	Count  uint64  `json:"count"`
+}
+
+// histIndex — индекс корзины для значения v мкс.
+func histIndex(v int64) int {
+	if v < histSubBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - histSubBucketBits // v>>shift в [histHalfBuckets, histSubBuckets)
+	return shift*histHalfBuckets + int(v>>shift)
+}
+
+// histBounds — границы корзины idx в микросекундах: [from, from+width).
+func histBounds(idx int) (from, width int64) {
+	if idx < histSubBuckets {
+		return int64(idx), 1
+	}
+	shift := idx/histHalfBuckets - 1
+	sub := int64(idx - shift*histHalfBuckets)
+	return sub << shift, int64(1) << shift
+}
+
+// Record добавляет задержку ms миллисекунд.
+func (h *LatencyHistogram) Record(ms float64) {
+	v := int64(math.Round(ms * 1000))
+	v = min(max(v, 0), histMaxMicros)
+	idx := histIndex(v)
+	if idx >= len(h.counts) {
+		h.counts = append(h.counts, make([]uint64, idx+1-len(h.counts))...)
+	}
+	h.counts[idx]++
+	if h.total == 0 || v < h.minUs {
+		h.minUs = v
+	}
+	if v > h.maxUs {
+		h.maxUs = v
+	}
+	h.total++
+	h.sumMs += ms
+}
+
+// Reset очищает гистограмму, сохраняя выделенную память.
+func (h *LatencyHistogram) Reset() {
+	clear(h.counts)
+	h.total, h.sumMs, h.minUs, h.maxUs = 0, 0, 0, 0
+}
+
+// MaxMs — наибольшее записанное значение (точное, до микросекунды).
+func (h *LatencyHistogram) MaxMs() float64 { return float64(h.maxUs) / 1000 }
+
+// MeanMs — среднее значение.
+func (h *LatencyHistogram) MeanMs() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sumMs / float64(h.total)
+}
+
+// PercentileMs — значение, не больше которого p процентов записанных: верхняя граница корзины,
+// в которую попал нужный ранг, но не больше максимума и не меньше минимума.
+func (h *LatencyHistogram) PercentileMs(p float64) float64 {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(h.total)))
+	rank = min(max(rank, 1), h.total)
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			from, width := histBounds(i)
+			v := min(max(from+width-1, h.minUs), h.maxUs)
+			return float64(v) / 1000
+		}
+	}
+	return h.MaxMs()
+}
+
+// Buckets возвращает непустые корзины по возрастанию.
+func (h *LatencyHistogram) Buckets() []HistogramBucket {
+	var out []HistogramBucket
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		from, width := histBounds(i)
+		out = append(out, HistogramBucket{FromMs: float64(from) / 1000, ToMs: float64(from+width) / 1000, Count: c})
+	}
+	return out
+}
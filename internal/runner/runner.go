@@ -3,6 +3,8 @@ package runner
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,6 +15,12 @@ import (
 // Run запускает все задачи через client с пулом из workers горутин и возвращает агрегированный результат.
 // Задачи раздаются воркерам по индексу; результаты собираются в порядке задач.
 func Run(ctx context.Context, tasks []tests.Task, workers int, client chclient.Client, queryTimeout time.Duration) (*tests.RunResult, error) {
+	return RunWithProgress(ctx, tasks, workers, client, queryTimeout, nil)
+}
+
+// RunWithProgress — Run с вызовом onResult на каждую завершённую задачу (в порядке завершения, из одной горутины).
+// Используется сервером для потоковой выдачи результатов; onResult может быть nil.
+func RunWithProgress(ctx context.Context, tasks []tests.Task, workers int, client chclient.Client, queryTimeout time.Duration, onResult func(tests.TestResult)) (*tests.RunResult, error) {
 	if workers < 1 {
 		workers = 1
 	}
@@ -40,13 +48,14 @@ func Run(ctx context.Context, tasks []tests.Task, workers int, client chclient.C
 	}
 	resultCh := make(chan resultItem, n)
 
+	var gate coldGate
 	var wg sync.WaitGroup
 	for w := 0; w < workers; w++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for i := range taskCh {
-				res := runOne(ctx, tasks[i], client, queryTimeout)
+				res := gate.runTask(ctx, tasks[i], client, queryTimeout)
 				resultCh <- resultItem{idx: i, res: res}
 			}
 		}()
@@ -59,16 +68,63 @@ func Run(ctx context.Context, tasks []tests.Task, workers int, client chclient.C
 
 	for item := range resultCh {
 		result.Results[item.idx] = item.res
-		if item.res.Pass {
+		switch {
+		case item.res.Pass:
 			result.Passed++
-		} else {
+		case item.res.Cancelled:
+			result.Cancelled++
+		default:
 			result.Failed++
 		}
+		if onResult != nil {
+			onResult(item.res)
+		}
 	}
 
 	return result, nil
 }
 
+// coldGate не даёт холодным замерам пересекаться с другими задачами пула: SYSTEM DROP ... CACHE действует
+// на весь сервер, и запросы соседних воркеров прогревали бы кэши между сбросом и замером (а их тёплые замеры
+// попадали бы на сброшенные кэши).
+type coldGate struct {
+	mu sync.RWMutex
+}
+
+// runTask выполняет задачу: с cache_mode cold/both — монопольно, остальные — параллельно между собой.
+func (g *coldGate) runTask(ctx context.Context, t tests.Task, client chclient.Client, queryTimeout time.Duration) tests.TestResult {
+	if t.Type == tests.TaskTypeQuery && (t.Opts.CacheMode == tests.CacheModeCold || t.Opts.CacheMode == tests.CacheModeBoth) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+	} else {
+		g.mu.RLock()
+		defer g.mu.RUnlock()
+	}
+	return runTask(ctx, t, client, queryTimeout)
+}
+
+// runTask выполняет задачу с учётом отмены: после отмены ctx новые задачи не запускаются,
+// а прерванные (завершившиеся ошибкой из-за отмены) помечаются Cancelled.
+func runTask(ctx context.Context, t tests.Task, client chclient.Client, queryTimeout time.Duration) tests.TestResult {
+	if ctx.Err() != nil {
+		return tests.TestResult{
+			TaskID:      t.ID,
+			Name:        t.Name,
+			Description: t.Description,
+			Query:       t.Query,
+			Type:        t.Type,
+			Cancelled:   true,
+			Error:       "cancelled",
+		}
+	}
+	res := runOne(ctx, t, client, queryTimeout)
+	if !res.Pass && len(res.AssertionFailures) == 0 && ctx.Err() != nil {
+		res.Cancelled = true
+		res.Error = "cancelled: " + res.Error
+	}
+	return res
+}
+
 func runOne(ctx context.Context, t tests.Task, client chclient.Client, queryTimeout time.Duration) tests.TestResult {
 	tr := tests.TestResult{
 		TaskID:      t.ID,
@@ -79,53 +135,245 @@ func runOne(ctx context.Context, t tests.Task, client chclient.Client, queryTime
 		Pass:        false,
 	}
 
-	if queryTimeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, queryTimeout)
-		defer cancel()
-	}
-
 	switch t.Type {
 	case tests.TaskTypeStructure:
-		_, _, _, _, err := client.Query(ctx, t.Query)
+		ctx, cancel := withQueryTimeout(ctx, queryTimeout)
+		defer cancel()
+		start := time.Now()
+		table, err := client.QueryTable(ctx, t.Query, t.Opts.MaxResultRows)
+		tr.DurationMs = time.Since(start).Seconds() * 1000
 		tr.Pass = err == nil
 		if err != nil {
 			tr.Error = err.Error()
+			return tr
+		}
+		tr.RowsReturned = table.TotalRows
+		tr.ResultTable = &tests.ResultTable{
+			Columns:   table.Columns,
+			Types:     table.Types,
+			Rows:      table.Rows,
+			TotalRows: table.TotalRows,
+		}
+		if t.Opts.Expect != nil || t.Opts.ReferenceDDL != nil {
+			schema, err := client.DescribeTable(ctx, t.Opts.Database, t.Opts.Table)
+			if err != nil {
+				tr.Pass = false
+				tr.Error = "describe table: " + err.Error()
+				return tr
+			}
+			var diffs []string
+			if t.Opts.Expect != nil {
+				diffs = append(diffs, compareStructure(t.Opts.Expect, schema)...)
+			}
+			if t.Opts.ReferenceDDL != nil {
+				ref, err := canonicalReference(ctx, client, t.Opts.ReferenceDDL)
+				refDiffs := compareDDL(ref, schema)
+				if err != nil && len(refDiffs) > 0 {
+					// без канонизации сервером часть расхождений может быть только в записи выражений
+					refDiffs = append(refDiffs, "reference_ddl: эталон сравнивался без formatQuery: "+err.Error())
+				}
+				diffs = append(diffs, refDiffs...)
+			}
+			if len(diffs) > 0 {
+				tr.Pass = false
+				tr.AssertionFailures = diffs
+				tr.Error = "structure: " + strings.Join(diffs, "; ")
+			}
 		}
 	case tests.TaskTypeQuery:
 		if t.Opts.CollectExplain {
-			explainText, err := client.Explain(ctx, t.Query)
+			explainCtx, cancel := withQueryTimeout(ctx, queryTimeout)
+			plan, err := client.Explain(explainCtx, t.Query)
+			cancel()
 			if err != nil {
 				tr.Error = "EXPLAIN: " + err.Error()
 				return tr
 			}
-			tr.ExplainText = explainText
-			tr.Granules = chclient.ExtractGranules(explainText)
-			tr.ProjectionUsed = chclient.ProjectionUsed(explainText)
+			tr.ExplainText = plan.Text
+			tr.Granules = chclient.ExtractGranules(plan.Text)
+			tr.IndexFunnel = indexFunnel(plan)
 		}
 
-		start := time.Now()
-		rows, readRows, readBytes, stats, err := client.Query(ctx, t.Query)
-		tr.DurationMs = time.Since(start).Seconds() * 1000
-		if err != nil {
+		for i := 0; i < t.Opts.Warmup; i++ {
+			warmCtx, cancel := withQueryTimeout(ctx, queryTimeout)
+			_, _, _, _, err := client.Query(warmCtx, t.Query, chclient.QueryOptions{})
+			cancel()
+			if err != nil {
+				tr.Error = "warmup: " + err.Error()
+				return tr
+			}
+		}
+
+		if err := measureQuery(ctx, t, client, queryTimeout, &tr); err != nil {
 			tr.Error = err.Error()
 			return tr
 		}
-
 		tr.Pass = true
+
+		if failures := evaluateAssertions(t.Opts.Assertions, &tr); len(failures) > 0 {
+			tr.Pass = false
+			tr.AssertionFailures = failures
+			tr.Error = "assertions: " + strings.Join(failures, "; ")
+		}
+	}
+
+	return tr
+}
+
+// measureQuery выполняет запрос t.Opts.Iterations раз и заполняет метрики tr.
+// Метрики, кроме сводки, берутся из последнего замера; при iterations > 1 длительность, read_rows и память — медианы.
+// В режиме cold перед каждым замером сбрасываются кэши сервера, в режиме both после холодного замера
+// выполняется тёплый, и в результат попадают оба времени (основные метрики — по тёплому).
+func measureQuery(ctx context.Context, t tests.Task, client chclient.Client, queryTimeout time.Duration, tr *tests.TestResult) error {
+	iterations := t.Opts.Iterations
+	if iterations < 1 {
+		iterations = 1
+	}
+	mode := t.Opts.CacheMode
+	cold := mode == tests.CacheModeCold || mode == tests.CacheModeBoth
+	opts := chclient.QueryOptions{CollectStats: t.Opts.CollectStats, DisableQueryCache: cold}
+
+	run := func() (float64, error) {
+		runCtx, cancel := withQueryTimeout(ctx, queryTimeout)
+		defer cancel()
+		start := time.Now()
+		rows, readRows, readBytes, stats, err := client.Query(runCtx, t.Query, opts)
+		durationMs := time.Since(start).Seconds() * 1000
+		if err != nil {
+			return durationMs, err
+		}
+		if stats != nil && stats.Elapsed > 0 {
+			// без времени на дочитывание метрик из query_log (SYSTEM FLUSH LOGS, повторы, system.parts)
+			durationMs = stats.Elapsed.Seconds() * 1000
+		}
 		tr.RowsReturned = rows
 		tr.ReadRows = readRows
 		tr.ReadBytes = readBytes
 		if stats != nil {
 			tr.QueryID = stats.QueryID
 			tr.MemoryUsage = stats.MemoryUsage
+			tr.ServerDurationMs = stats.QueryDurationMs
+			tr.ProfileEvents = stats.ProfileEvents
+			if stats.FromQueryLog {
+				tr.Projections = stats.Projections
+				tr.ProjectionUsed = len(stats.Projections) > 0
+				tr.ProjectionSource = tests.ProjectionSourceQueryLog
+			}
 			tr.Partitions = stats.Partitions
 			tr.PartitionDetails = make([]tests.PartitionInfo, 0, len(stats.PartitionDetails))
 			for _, d := range stats.PartitionDetails {
 				tr.PartitionDetails = append(tr.PartitionDetails, tests.PartitionInfo{Partition: d.Partition, Rows: d.Rows, Bytes: d.Bytes})
 			}
 		}
+		return durationMs, nil
+	}
+	iterErr := func(i int, kind string, err error) error {
+		if iterations > 1 {
+			kind = fmt.Sprintf("iteration %d/%d: %s", i+1, iterations, kind)
+		}
+		if kind == "" {
+			return err
+		}
+		return fmt.Errorf("%s%w", kind, err)
 	}
 
-	return tr
+	durations := make([]float64, 0, iterations)
+	coldDurations := make([]float64, 0, iterations)
+	readRowsSamples := make([]float64, 0, iterations)
+	memorySamples := make([]float64, 0, iterations)
+	for i := 0; i < iterations; i++ {
+		if cold {
+			dropCtx, cancel := withQueryTimeout(ctx, queryTimeout)
+			err := client.DropCaches(dropCtx)
+			cancel()
+			if err != nil {
+				for _, w := range strings.Split(err.Error(), "\n") {
+					if !containsString(tr.CacheWarnings, w) {
+						tr.CacheWarnings = append(tr.CacheWarnings, w)
+					}
+				}
+			}
+			d, err := run()
+			if err != nil {
+				return iterErr(i, "cold run: ", err)
+			}
+			coldDurations = append(coldDurations, d)
+		}
+		if mode != tests.CacheModeCold {
+			d, err := run()
+			if err != nil {
+				return iterErr(i, "", err)
+			}
+			durations = append(durations, d)
+		} else {
+			durations = append(durations, coldDurations[i])
+		}
+		readRowsSamples = append(readRowsSamples, float64(tr.ReadRows))
+		memorySamples = append(memorySamples, float64(tr.MemoryUsage))
+	}
+
+	tr.DurationMs = durations[len(durations)-1]
+	if iterations > 1 {
+		tr.Iterations = iterations
+		tr.Warmup = t.Opts.Warmup
+		tr.DurationStats = summarize(durations)
+		tr.ReadRowsStats = summarize(readRowsSamples)
+		tr.DurationMs = tr.DurationStats.Median
+		tr.ReadRows = uint64(tr.ReadRowsStats.Median)
+		if tr.MemoryUsage > 0 {
+			tr.MemoryStats = summarize(memorySamples)
+			tr.MemoryUsage = uint64(tr.MemoryStats.Median)
+		}
+	}
+	if cold {
+		tr.CacheMode = mode
+		tr.ColdDurationMs = coldDurations[len(coldDurations)-1]
+		if iterations > 1 {
+			tr.ColdDurationMs = summarize(coldDurations).Median
+		}
+		if mode == tests.CacheModeBoth {
+			tr.WarmDurationMs = tr.DurationMs
+			if iterations > 1 {
+				tr.ColdDurationStats = summarize(coldDurations)
+			}
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// withQueryTimeout ограничивает один запрос таймаутом execution.query_timeout_sec (0 — без ограничения).
+func withQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// indexFunnel переводит стадии отсечения из плана EXPLAIN в плоский список для отчёта.
+func indexFunnel(plan *chclient.ExplainPlan) []tests.IndexStage {
+	var out []tests.IndexStage
+	for _, step := range plan.ReadSteps() {
+		for _, st := range step.Indexes {
+			out = append(out, tests.IndexStage{
+				Table:          step.Detail,
+				Stage:          st.Stage,
+				Name:           st.Name,
+				IndexType:      st.IndexType,
+				PartsBefore:    st.PartsBefore,
+				PartsAfter:     st.PartsAfter,
+				GranulesBefore: st.GranulesBefore,
+				GranulesAfter:  st.GranulesAfter,
+			})
+		}
+	}
+	return out
 }
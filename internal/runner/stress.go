@@ -4,6 +4,10 @@ package runner
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -16,126 +20,681 @@ import (
 
 const timeOffsetPlaceholder = "$time_offset_ms$"
 
-// StressResult — результат стресс-теста.
+// Модели нагрузки стресс-теста.
+const (
+	StressModeClosed = "closed" // каждый воркер отправляет следующий запрос сразу после ответа на предыдущий
+	StressModeOpen   = "open"   // запросы по часам прихода с постоянной частотой, независимо от ответов
+)
+
+// rampStep — наибольший шаг часов прихода на рампе: частота пересчитывается не реже, чем раз в rampStep,
+// иначе при подъёме от нуля первый интервал 1/rate растягивался бы на всю ступень.
+const rampStep = 10 * time.Millisecond
+
+// maxErrorKinds — сколько разных видов ошибок считается по отдельности; остальные попадают в errorKindOther.
+const (
+	maxErrorKinds  = 20
+	errorKindOther = "other"
+)
+
+// StressOptions — параметры стресс-теста.
+type StressOptions struct {
+	Workers      int           // closed: число воркеров
+	TargetQPS    float64       // > 0 — open: запросов в секунду по часам прихода
+	MaxInFlight  int           // open: максимум одновременно выполняющихся запросов (по умолчанию Workers)
+	QueryTimeout time.Duration // таймаут одного запроса (0 — без ограничения)
+	Stages       []StressStage // профиль нагрузки; пусто — одна ступень Workers/TargetQPS до отмены ctx
+	Queries      []StressQuery // смесь шаблонов с весами; пусто — только baseQuery
+	// ServerStats — после теста собрать серверные метрики из system.query_log (запросы теста помечаются
+	// общим префиксом query_id); результат в StressResult.Server.
+	ServerStats bool
+}
+
+// Concurrency — сколько запросов теста может выполняться одновременно: open — MaxInFlight,
+// closed — Workers или, с профилем, пик воркеров по ступеням. Столько соединений нужно в пуле клиента
+// (chclient.ConnectOptions.MaxOpenConns).
+func (o StressOptions) Concurrency() int {
+	stages := o.Stages
+	if len(stages) == 0 {
+		stages = []StressStage{{Workers: o.Workers, TargetQPS: o.TargetQPS}}
+	}
+	open, peak := false, 0
+	for _, st := range stages {
+		open = open || st.TargetQPS > 0
+		peak = max(peak, st.Workers)
+	}
+	if open {
+		if o.MaxInFlight > 0 {
+			return o.MaxInFlight
+		}
+		return max(o.Workers, 1)
+	}
+	return max(peak, 1)
+}
+
+// StressQuery — шаблон запроса в смеси стресс-теста: доля запросов пропорциональна Weight.
+type StressQuery struct {
+	Name   string
+	Query  string // запрос с плейсхолдером $time_offset_ms$
+	Weight float64
+}
+
+// StressStage — ступень профиля нагрузки: цель (воркеры или QPS) на время Duration.
+// Все ступени профиля — одной модели: либо Workers (closed), либо TargetQPS (open).
+type StressStage struct {
+	Duration  time.Duration // длительность ступени (0 — до отмены ctx, только для последней)
+	Workers   int           // closed: число воркеров
+	TargetQPS float64       // open: запросов в секунду
+	Ramp      bool          // цель меняется линейно от цели предыдущей ступени (для первой — от нуля)
+}
+
+// StressStats — метрики стресс-теста за весь прогон или за одну ступень.
+type StressStats struct {
+	Total        int      `json:"total"`             // всего запросов (success + failed + cancelled)
+	Success      int      `json:"success"`           // успешных
+	Failed       int      `json:"failed"`            // с ошибкой БД/сети
+	Cancelled    int      `json:"cancelled"`         // оборваны по отмене контекста (конец теста)
+	Dropped      int      `json:"dropped,omitempty"` // open: не отправлены — все max_in_flight слотов заняты
+	Late         int      `json:"late,omitempty"`    // open: отправлены позже плана больше чем на интервал между запросами
+	DurationSec  float64  `json:"duration_sec"`      // длительность в секундах
+	QPS          float64  `json:"qps"`               // запросов в секунду
+	LatencyP50Ms float64  `json:"p50_ms"`            // медиана задержки, мс (open — от планового времени отправки)
+	LatencyP95Ms float64  `json:"p95_ms"`            // p95 задержки, мс
+	LatencyP99Ms float64  `json:"p99_ms"`            // p99 задержки, мс
+	LatencyMaxMs float64  `json:"max_ms"`            // максимальная задержка, мс
+	LatencyAvgMs float64  `json:"avg_ms"`            // средняя задержка, мс
+	ErrorSamples []string `json:"error_samples"`     // примеры ошибок (до 5)
+	// ErrorBreakdown — ошибки по видам (текст без чисел, кроме кода ClickHouse), по убыванию числа.
+	ErrorBreakdown []StressErrorCount `json:"error_breakdown,omitempty"`
+}
+
+// StressErrorCount — число ошибок одного вида.
+type StressErrorCount struct {
+	Error string `json:"error"`
+	Count int    `json:"count"`
+}
+
+// StressServerStats — серверные метрики запросов теста из system.query_log (StressOptions.ServerStats).
+type StressServerStats struct {
+	Queries       uint64                  `json:"queries"` // запросов в query_log (завершённых и с исключением)
+	Exceptions    uint64                  `json:"exceptions"`
+	DurationAvgMs float64                 `json:"duration_avg_ms"` // query_duration_ms — время на сервере
+	DurationP50Ms float64                 `json:"duration_p50_ms"`
+	DurationP95Ms float64                 `json:"duration_p95_ms"`
+	DurationP99Ms float64                 `json:"duration_p99_ms"`
+	DurationMaxMs float64                 `json:"duration_max_ms"`
+	ReadRows      uint64                  `json:"read_rows"`
+	ReadBytes     uint64                  `json:"read_bytes"`
+	MemoryAvg     float64                 `json:"memory_avg"` // memory_usage, байт
+	MemoryMax     uint64                  `json:"memory_max"`
+	ProfileEvents map[string]uint64       `json:"profile_events,omitempty"`
+	TopExceptions []StressServerException `json:"top_exceptions,omitempty"`
+	Error         string                  `json:"error,omitempty"` // почему метрики не получены (нет прав на query_log и т.п.)
+}
+
+// StressServerException — число запросов с данным кодом исключения ClickHouse.
+type StressServerException struct {
+	Code  int32  `json:"code"`
+	Name  string `json:"name"`
+	Count uint64 `json:"count"`
+}
+
+// StressResult — результат стресс-теста (поля с json для API -serve).
 type StressResult struct {
-	Total        int      // всего запросов (success + failed + cancelled)
-	Success      int      // успешных
-	Failed       int      // с ошибкой БД/сети
-	Cancelled    int      // оборваны по отмене контекста (конец теста)
-	DurationSec  float64  // длительность в секундах
-	QPS          float64  // запросов в секунду
-	LatencyP50Ms float64  // медиана задержки, мс
-	LatencyP95Ms float64  // p95 задержки, мс
-	LatencyP99Ms float64  // p99 задержки, мс
-	ErrorSamples []string // примеры ошибок (до 5)
+	Mode        string  `json:"mode"`                    // closed или open
+	TargetQPS   float64 `json:"target_qps,omitempty"`    // open без профиля: заданная частота
+	MaxInFlight int     `json:"max_in_flight,omitempty"` // open: предел одновременных запросов
+	StressStats
+	Stages    []StressStageResult    `json:"stages,omitempty"`    // по ступеням профиля (только если профиль задан)
+	Templates []StressTemplateResult `json:"templates,omitempty"` // по шаблонам (только если задана смесь)
+	Intervals []StressInterval       `json:"intervals,omitempty"` // ряд метрик по секундам за весь тест
+	Histogram []HistogramBucket      `json:"histogram"`           // гистограмма задержек успешных запросов за весь тест
+	Server    *StressServerStats     `json:"server,omitempty"`    // серверные метрики (только с ServerStats)
+}
+
+// StressTemplateResult — метрики одного шаблона из смеси. QPS — доля шаблона в общей нагрузке.
+type StressTemplateResult struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	StressStats
+}
+
+// StressStageResult — метрики одной ступени профиля. Запрос относится к ступени, на которой он отправлен.
+type StressStageResult struct {
+	Stage     int     `json:"stage"` // номер ступени (с 1)
+	Workers   int     `json:"workers,omitempty"`
+	TargetQPS float64 `json:"target_qps,omitempty"`
+	Ramp      bool    `json:"ramp,omitempty"`
+	StartSec  float64 `json:"start_sec"` // начало ступени от старта теста
+	StressStats
+}
+
+// StressInterval — метрики стресс-теста за одну секунду (для графиков в -serve).
+type StressInterval struct {
+	Second       int     `json:"second"`          // номер секунды с начала теста (1, 2, ...)
+	Stage        int     `json:"stage,omitempty"` // ступень профиля в конце секунды (только если профиль задан)
+	Workers      int     `json:"workers,omitempty"`
+	TargetQPS    float64 `json:"target_qps,omitempty"`
+	Requests     int     `json:"requests"` // завершённых запросов за секунду (включая ошибки)
+	Errors       int     `json:"errors"`
+	Dropped      int     `json:"dropped,omitempty"`
+	Late         int     `json:"late,omitempty"`
+	QPS          float64 `json:"qps"`
+	LatencyP50Ms float64 `json:"p50_ms"` // перцентили задержки успешных запросов
+	LatencyP95Ms float64 `json:"p95_ms"`
+	LatencyP99Ms float64 `json:"p99_ms"`
+	LatencyMaxMs float64 `json:"max_ms"`
+}
+
+// stressSample — исход одного запроса (или пропуска в open-модели) для сборщика метрик.
+type stressSample struct {
+	stage      int // номер ступени, на которой запрос отправлен (с 1)
+	query      int // индекс шаблона в смеси
+	durationMs float64
+	err        error
+	cancelled  bool // запрос оборван отменой теста (а не своим таймаутом)
+	dropped    bool // запрос не отправлен: нет свободного слота
+	late       bool // запрос отправлен с опозданием относительно часов прихода
 }
 
 // RunStress запускает стресс-тест: до отмены ctx в workers горутинах выполняется baseQuery.
 // В baseQuery должен быть плейсхолдер $time_offset_ms$; на каждый запрос он заменяется на новое значение (0, 1, 2, ...),
 // чтобы запрос не кэшировался. Возвращает сводку: total, success, failed, QPS, перцентили задержки.
 func RunStress(ctx context.Context, baseQuery string, workers int, queryTimeout time.Duration, client chclient.Client) *StressResult {
-	if workers < 1 {
-		workers = 1
+	return RunStressWithProgress(ctx, baseQuery, StressOptions{Workers: workers, QueryTimeout: queryTimeout}, client, nil)
+}
+
+// RunStressWithProgress — стресс-тест по opts с вызовом onInterval раз в секунду (и для неполной последней секунды).
+// При opts.TargetQPS > 0 нагрузка открытая: запрос i планируется на момент start + i/TargetQPS и отправляется,
+// если свободен один из MaxInFlight слотов (иначе считается dropped). Задержка считается от планового момента,
+// поэтому очередь на стороне клиента не скрывает деградацию сервера (coordinated omission).
+// С opts.Stages ступени применяются по очереди (число воркеров или частота меняются на ходу), тест завершается
+// после последней ступени; метрики дополнительно считаются по каждой ступени.
+// С opts.Queries каждый запрос выбирается из смеси шаблонов случайно по весам (baseQuery не используется),
+// метрики дополнительно считаются по каждому шаблону.
+// onInterval вызывается из одной горутины и может быть nil.
+func RunStressWithProgress(ctx context.Context, baseQuery string, opts StressOptions, client chclient.Client, onInterval func(StressInterval)) *StressResult {
+	staged := len(opts.Stages) > 0
+	stages := opts.Stages
+	if !staged {
+		stages = []StressStage{{Workers: max(opts.Workers, 1), TargetQPS: opts.TargetQPS}}
+	}
+	open := false
+	for _, st := range stages {
+		open = open || st.TargetQPS > 0
 	}
-	if !strings.Contains(baseQuery, timeOffsetPlaceholder) {
-		// без плейсхолдера все запросы одинаковые (кэш)
-		baseQuery = baseQuery + " -- no $time_offset_ms$"
+	mixed := len(opts.Queries) > 0
+	queries := opts.Queries
+	if !mixed {
+		queries = []StressQuery{{Query: baseQuery, Weight: 1}}
+	}
+	texts := make([]string, len(queries))
+	cumWeights := make([]float64, len(queries)) // нарастающие веса для выбора шаблона
+	totalWeight := 0.0
+	for i, q := range queries {
+		texts[i] = q.Query
+		if !strings.Contains(q.Query, timeOffsetPlaceholder) {
+			// без плейсхолдера все запросы одинаковые (кэш)
+			texts[i] = q.Query + " -- no $time_offset_ms$"
+		}
+		totalWeight += max(q.Weight, 0)
+		cumWeights[i] = totalWeight
 	}
 
 	var counter uint64
-	var latenciesMu sync.Mutex
-	latencies := make([]float64, 0, 1024)
-	var errorsMu sync.Mutex
-	errorSamples := make([]string, 0, 5)
-
-	resultCh := make(chan struct {
-		durationMs float64
-		err       error
-	}, workers*32)
-
-	start := time.Now()
-	var wg sync.WaitGroup
-	for w := 0; w < workers; w++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-				}
-				offset := atomic.AddUint64(&counter, 1)
-				q := strings.ReplaceAll(baseQuery, timeOffsetPlaceholder, strconv.FormatUint(offset, 10))
-				t0 := time.Now()
-				var err error
-				if queryTimeout > 0 {
-					runCtx, cancel := context.WithTimeout(ctx, queryTimeout)
-					_, _, _, _, err = client.Query(runCtx, q)
-					cancel()
-				} else {
-					_, _, _, _, err = client.Query(ctx, q)
-				}
-				durationMs := time.Since(t0).Seconds() * 1000
-				resultCh <- struct {
-					durationMs float64
-					err       error
-				}{durationMs, err}
+	queryOpts := chclient.QueryOptions{SkipQueryLog: true}
+	if opts.ServerStats {
+		queryOpts.QueryIDPrefix = fmt.Sprintf("ct-stress-%08x-", rand.Uint32())
+	}
+	d := &stressDriver{
+		query: func(ctx context.Context, i int) error {
+			offset := atomic.AddUint64(&counter, 1)
+			q := strings.ReplaceAll(texts[i], timeOffsetPlaceholder, strconv.FormatUint(offset, 10))
+			runCtx, cancel := withQueryTimeout(ctx, opts.QueryTimeout)
+			defer cancel()
+			_, _, _, _, err := client.Query(runCtx, q, queryOpts)
+			return err
+		},
+		pick: func() int {
+			if len(cumWeights) == 1 || totalWeight <= 0 {
+				return 0
+			}
+			i := sort.SearchFloat64s(cumWeights, rand.Float64()*totalWeight)
+			return min(i, len(cumWeights)-1)
+		},
+		start:   time.Now(),
+		stages:  stages,
+		staged:  staged,
+		queries: queries,
+		mixed:   mixed,
+	}
+	result := &StressResult{Mode: StressModeClosed}
+	resultCh := make(chan stressSample, max(opts.Workers, opts.MaxInFlight, 1)*32)
+	d.out = resultCh
+	if open {
+		if opts.MaxInFlight < 1 {
+			opts.MaxInFlight = max(opts.Workers, 1)
+		}
+		result.Mode = StressModeOpen
+		result.MaxInFlight = opts.MaxInFlight
+		if !staged {
+			result.TargetQPS = opts.TargetQPS
+		}
+		go d.run(func() { d.driveOpen(ctx, opts.MaxInFlight) })
+	} else {
+		go d.run(func() { d.driveClosed(ctx) })
+	}
+	collectStress(d, resultCh, result, onInterval)
+	if opts.ServerStats {
+		result.Server = serverStats(client, queryOpts.QueryIDPrefix, d.start)
+	}
+	return result
+}
+
+// serverStats читает сводку query_log по запросам теста. Контекст отдельный: контекст теста к этому моменту отменён.
+func serverStats(client chclient.Client, prefix string, since time.Time) *StressServerStats {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	// секунда запаса: event_time в query_log с точностью до секунды
+	s, err := client.QueryLogSummary(ctx, prefix, since.Add(-time.Second))
+	if err != nil {
+		return &StressServerStats{Error: err.Error()}
+	}
+	out := &StressServerStats{
+		Queries:       s.Queries,
+		Exceptions:    s.Exceptions,
+		DurationAvgMs: s.DurationAvgMs,
+		DurationP50Ms: s.DurationP50Ms,
+		DurationP95Ms: s.DurationP95Ms,
+		DurationP99Ms: s.DurationP99Ms,
+		DurationMaxMs: s.DurationMaxMs,
+		ReadRows:      s.ReadRows,
+		ReadBytes:     s.ReadBytes,
+		MemoryAvg:     s.MemoryAvg,
+		MemoryMax:     s.MemoryMax,
+		ProfileEvents: s.ProfileEvents,
+	}
+	for _, e := range s.TopExceptions {
+		out.TopExceptions = append(out.TopExceptions, StressServerException{Code: e.Code, Name: e.Name, Count: e.Count})
+	}
+	return out
+}
+
+// stressDriver — генератор нагрузки: применяет ступени и отправляет исходы запросов в out.
+type stressDriver struct {
+	query func(ctx context.Context, i int) error // выполнить шаблон i
+	pick  func() int                             // выбрать шаблон по весам
+	out   chan<- stressSample
+	start time.Time
+	wg    sync.WaitGroup // воркеры и выполняющиеся запросы
+
+	stages  []StressStage
+	staged  bool // ступени заданы профилем (иначе одна неявная)
+	queries []StressQuery
+	mixed   bool // шаблоны заданы смесью (иначе один baseQuery)
+
+	stage   atomic.Int32  // текущая ступень (с 1)
+	workers atomic.Int32  // closed: текущее число воркеров
+	rate    atomic.Uint64 // open: текущая частота (math.Float64bits)
+
+	// stageStarts — моменты начала ступеней; читаются сборщиком после закрытия out.
+	stageStarts []time.Time
+}
+
+// run выполняет drive, дожидается завершения всех запросов и закрывает out.
+func (d *stressDriver) run(drive func()) {
+	drive()
+	d.wg.Wait()
+	close(d.out)
+}
+
+// beginStage отмечает начало ступени i (с 0).
+func (d *stressDriver) beginStage(i int, at time.Time) {
+	d.stageStarts = append(d.stageStarts, at)
+	d.stage.Store(int32(i + 1))
+}
+
+// rampValue — цель ступени в момент at: с рампой — линейно от from к to за время ступени.
+func rampValue(st StressStage, from, to float64, stageStart, at time.Time) float64 {
+	if !st.Ramp || st.Duration <= 0 {
+		return to
+	}
+	frac := float64(at.Sub(stageStart)) / float64(st.Duration)
+	frac = math.Min(math.Max(frac, 0), 1)
+	return from + (to-from)*frac
+}
+
+// driveClosed — закрытая модель: пул воркеров, размер которого меняется по ступеням.
+// Лишние воркеры останавливаются после ответа на текущий запрос; на рампе размер пересчитывается раз в секунду.
+func (d *stressDriver) driveClosed(ctx context.Context) {
+	var stops []chan struct{}
+	resize := func(n int) {
+		for len(stops) < n {
+			stop := make(chan struct{})
+			stops = append(stops, stop)
+			d.wg.Add(1)
+			go d.worker(ctx, stop)
+		}
+		for len(stops) > n {
+			close(stops[len(stops)-1])
+			stops = stops[:len(stops)-1]
+		}
+		d.workers.Store(int32(n))
+	}
+	defer resize(0)
+
+	prev := 0
+	stageStart := d.start
+	for i, st := range d.stages {
+		d.beginStage(i, stageStart)
+		end := stageStart.Add(st.Duration)
+		for {
+			now := time.Now()
+			resize(int(math.Round(rampValue(st, float64(prev), float64(st.Workers), stageStart, now))))
+			wait := time.Until(end)
+			if st.Duration <= 0 {
+				wait = math.MaxInt64
+			} else if wait <= 0 {
+				break
+			}
+			if st.Ramp && wait > time.Second {
+				wait = time.Second
 			}
-		}()
-	}
-
-	go func() {
-		wg.Wait()
-		close(resultCh)
-	}()
-
-	var total, success, failed, cancelled int
-	for r := range resultCh {
-		total++
-		if r.err != nil {
-			if isContextCanceled(r.err) {
-				cancelled++
-			} else {
-				failed++
-				errorsMu.Lock()
-				if len(errorSamples) < 5 {
-					errorSamples = append(errorSamples, r.err.Error())
+			if !sleepCtx(ctx, wait) {
+				return
+			}
+		}
+		prev = st.Workers
+		stageStart = end
+	}
+}
+
+// worker выполняет запросы подряд до закрытия stop или отмены ctx.
+func (d *stressDriver) worker(ctx context.Context, stop <-chan struct{}) {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		default:
+		}
+		stage, q := int(d.stage.Load()), d.pick()
+		t0 := time.Now()
+		err := d.query(ctx, q)
+		d.out <- stressSample{stage: stage, query: q, durationMs: time.Since(t0).Seconds() * 1000, err: err, cancelled: err != nil && ctx.Err() != nil}
+	}
+}
+
+// driveOpen — открытая модель: следующий запрос планируется через 1/rate после предыдущего, rate — цель ступени.
+// На рампе часы идут шагами не больше rampStep, а запрос отправляется, когда накопленное rate·шаг достигает 1.
+// Если отстали от часов, запросы отправляются сразу (и помечаются late, если опоздание больше интервала между
+// запросами); если заняты все maxInFlight слотов — запрос не отправляется (dropped).
+func (d *stressDriver) driveOpen(ctx context.Context, maxInFlight int) {
+	slots := make(chan struct{}, maxInFlight)
+	next := d.start
+	prev := 0.0
+	credit := 0.0 // накопленная доля следующего запроса
+	stageStart := d.start
+	for i, st := range d.stages {
+		d.beginStage(i, stageStart)
+		if next.After(stageStart) {
+			// после ступени с редкими запросами не переносим её интервал в следующую
+			next = stageStart
+		}
+		end := stageStart.Add(st.Duration)
+		for st.Duration <= 0 || next.Before(end) {
+			rate := rampValue(st, prev, st.TargetQPS, stageStart, next)
+			d.rate.Store(math.Float64bits(rate))
+			step, period := rampStep, time.Duration(math.MaxInt64)
+			if rate > 0 {
+				period = time.Duration(float64(time.Second) / rate)
+				if !st.Ramp || period < step {
+					step = period
 				}
-				errorsMu.Unlock()
 			}
-		} else {
-			success++
-			latenciesMu.Lock()
-			latencies = append(latencies, r.durationMs)
-			latenciesMu.Unlock()
+			intended := next
+			next = next.Add(step)
+			if !sleepCtx(ctx, time.Until(intended)) {
+				return
+			}
+			if credit += rate * step.Seconds(); credit < 1-1e-9 {
+				continue
+			}
+			credit = math.Max(credit-1, 0)
+			q := d.pick()
+			select {
+			case slots <- struct{}{}:
+			default:
+				d.out <- stressSample{stage: i + 1, query: q, dropped: true}
+				continue
+			}
+			late := time.Since(intended) > period
+			d.wg.Add(1)
+			go func(stage int) {
+				defer d.wg.Done()
+				err := d.query(ctx, q)
+				<-slots
+				d.out <- stressSample{stage: stage, query: q, durationMs: time.Since(intended).Seconds() * 1000, err: err, cancelled: err != nil && ctx.Err() != nil, late: late}
+			}(i + 1)
 		}
+		prev = st.TargetQPS
+		stageStart = end
 	}
-	durationSec := time.Since(start).Seconds()
+}
 
-	result := &StressResult{
-		Total:        total,
-		Success:      success,
-		Failed:       failed,
-		Cancelled:    cancelled,
-		DurationSec:  durationSec,
-		ErrorSamples: errorSamples,
+// sleepCtx ждёт wait; false — если ctx отменён раньше (или уже отменён).
+func sleepCtx(ctx context.Context, wait time.Duration) bool {
+	if wait <= 0 {
+		return ctx.Err() == nil
 	}
-	if result.DurationSec > 0 {
-		result.QPS = float64(total) / result.DurationSec
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
 	}
-	if len(latencies) > 0 {
-		sort.Float64s(latencies)
-		n := len(latencies)
-		result.LatencyP50Ms = percentile(latencies, n, 50)
-		result.LatencyP95Ms = percentile(latencies, n, 95)
-		result.LatencyP99Ms = percentile(latencies, n, 99)
+}
+
+// stressAcc накапливает метрики по исходам запросов (за весь тест, ступень или шаблон).
+type stressAcc struct {
+	stats  StressStats
+	hist   LatencyHistogram
+	errors map[string]int // по errorKind
+}
+
+func newStressAcc() *stressAcc {
+	return &stressAcc{stats: StressStats{ErrorSamples: make([]string, 0, 5)}, errors: make(map[string]int)}
+}
+
+func (a *stressAcc) add(r stressSample) {
+	if r.dropped {
+		a.stats.Dropped++
+		return
+	}
+	a.stats.Total++
+	if r.late {
+		a.stats.Late++
+	}
+	switch {
+	case r.cancelled:
+		a.stats.Cancelled++
+	case r.err != nil:
+		a.stats.Failed++
+		if len(a.stats.ErrorSamples) < 5 {
+			a.stats.ErrorSamples = append(a.stats.ErrorSamples, r.err.Error())
+		}
+		kind := errorKind(r.err)
+		if _, ok := a.errors[kind]; !ok && len(a.errors) >= maxErrorKinds {
+			kind = errorKindOther
+		}
+		a.errors[kind]++
+	default:
+		a.stats.Success++
+		a.hist.Record(r.durationMs)
 	}
-	return result
 }
 
-func isContextCanceled(err error) bool {
-	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+// finish считает QPS и перцентили за durationSec секунд.
+func (a *stressAcc) finish(durationSec float64) StressStats {
+	s := a.stats
+	s.DurationSec = durationSec
+	if durationSec > 0 {
+		s.QPS = float64(s.Total) / durationSec
+	}
+	s.LatencyP50Ms = a.hist.PercentileMs(50)
+	s.LatencyP95Ms = a.hist.PercentileMs(95)
+	s.LatencyP99Ms = a.hist.PercentileMs(99)
+	s.LatencyMaxMs = a.hist.MaxMs()
+	s.LatencyAvgMs = a.hist.MeanMs()
+	for kind, n := range a.errors {
+		s.ErrorBreakdown = append(s.ErrorBreakdown, StressErrorCount{Error: kind, Count: n})
+	}
+	sort.Slice(s.ErrorBreakdown, func(i, j int) bool {
+		if s.ErrorBreakdown[i].Count != s.ErrorBreakdown[j].Count {
+			return s.ErrorBreakdown[i].Count > s.ErrorBreakdown[j].Count
+		}
+		return s.ErrorBreakdown[i].Error < s.ErrorBreakdown[j].Error
+	})
+	return s
+}
+
+var (
+	errorCodeRe   = regexp.MustCompile(`code: (\d+)`)
+	errorNumberRe = regexp.MustCompile(`\d+`)
+)
+
+// errorKind — вид ошибки для разбивки: первая строка текста, числа заменены на N (код ClickHouse сохраняется),
+// не длиннее 120 символов. Так ошибки, различающиеся только значениями (строки, байты, смещения), сливаются.
+func errorKind(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "query timeout"
+	}
+	msg, _, _ := strings.Cut(err.Error(), "\n")
+	code := errorCodeRe.FindStringSubmatch(msg)
+	msg = errorNumberRe.ReplaceAllString(msg, "N")
+	if code != nil {
+		msg = strings.Replace(msg, "code: N", code[0], 1)
+	}
+	if r := []rune(msg); len(r) > 120 {
+		msg = string(r[:120]) + "…"
+	}
+	return msg
+}
+
+// collectStress собирает исходы запросов в result (и по ступеням профиля и шаблонам смеси, если они заданы)
+// и раз в секунду добавляет метрики интервала в result.Intervals и отдаёт их в onInterval (если не nil).
+// Задержки копятся в гистограммах, поэтому память не растёт с числом запросов.
+func collectStress(d *stressDriver, in <-chan stressSample, result *StressResult, onInterval func(StressInterval)) {
+	total := newStressAcc()
+	perStage := make([]*stressAcc, len(d.stages))
+	for i := range perStage {
+		perStage[i] = newStressAcc()
+	}
+	perQuery := make([]*stressAcc, len(d.queries))
+	for i := range perQuery {
+		perQuery[i] = newStressAcc()
+	}
+
+	var cur StressInterval
+	var curHist LatencyHistogram
+	intervalStart := d.start
+	flush := func(now time.Time) {
+		cur.Second++
+		if d.staged {
+			cur.Stage = int(d.stage.Load())
+		}
+		if result.Mode == StressModeOpen {
+			cur.TargetQPS = math.Float64frombits(d.rate.Load())
+		} else {
+			cur.Workers = int(d.workers.Load())
+		}
+		if sec := now.Sub(intervalStart).Seconds(); sec > 0 {
+			cur.QPS = float64(cur.Requests) / sec
+		}
+		cur.LatencyP50Ms = curHist.PercentileMs(50)
+		cur.LatencyP95Ms = curHist.PercentileMs(95)
+		cur.LatencyP99Ms = curHist.PercentileMs(99)
+		cur.LatencyMaxMs = curHist.MaxMs()
+		result.Intervals = append(result.Intervals, cur)
+		if onInterval != nil {
+			onInterval(cur)
+		}
+		cur = StressInterval{Second: cur.Second}
+		curHist.Reset()
+		intervalStart = now
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for done := false; !done; {
+		select {
+		case now := <-ticker.C:
+			flush(now)
+		case r, ok := <-in:
+			if !ok {
+				done = true
+				break
+			}
+			total.add(r)
+			if r.stage >= 1 && r.stage <= len(perStage) {
+				perStage[r.stage-1].add(r)
+			}
+			if r.query >= 0 && r.query < len(perQuery) {
+				perQuery[r.query].add(r)
+			}
+			switch {
+			case r.dropped:
+				cur.Dropped++
+			case r.cancelled:
+			case r.err != nil:
+				cur.Requests++
+				cur.Errors++
+			default:
+				cur.Requests++
+				curHist.Record(r.durationMs)
+			}
+			if r.late {
+				cur.Late++
+			}
+		}
+	}
+	finished := time.Now()
+	if cur.Requests > 0 || cur.Dropped > 0 {
+		flush(finished)
+	}
+	result.StressStats = total.finish(finished.Sub(d.start).Seconds())
+	result.Histogram = total.hist.Buckets()
+
+	if d.mixed {
+		for i, q := range d.queries {
+			result.Templates = append(result.Templates, StressTemplateResult{
+				Name:        q.Name,
+				Weight:      q.Weight,
+				StressStats: perQuery[i].finish(result.DurationSec),
+			})
+		}
+	}
+	if !d.staged {
+		return
+	}
+	for i, at := range d.stageStarts {
+		end := finished
+		if i+1 < len(d.stageStarts) {
+			end = d.stageStarts[i+1]
+		}
+		st := d.stages[i]
+		result.Stages = append(result.Stages, StressStageResult{
+			Stage:       i + 1,
+			Workers:     st.Workers,
+			TargetQPS:   st.TargetQPS,
+			Ramp:        st.Ramp,
+			StartSec:    at.Sub(d.start).Seconds(),
+			StressStats: perStage[i].finish(end.Sub(at).Seconds()),
+		})
+	}
 }
 
 func percentile(sorted []float64, n, p int) float64 {
@@ -0,0 +1,243 @@
+// Package runner — сравнение фактической структуры таблицы с эталоном структурной проверки.
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"clicktester/internal/chclient"
+	"clicktester/internal/ddl"
+	"clicktester/internal/tests"
+)
+
+// compareStructure сравнивает структуру таблицы с эталоном; каждое расхождение — отдельная строка
+// вида "что: факт ..., ожидается ...".
+func compareStructure(spec *tests.StructureSpec, s *chclient.TableSchema) []string {
+	var diffs []string
+
+	for _, want := range spec.Indexes {
+		var got *chclient.SkipIndexInfo
+		for i := range s.SkipIndices {
+			if s.SkipIndices[i].Name == want.Name {
+				got = &s.SkipIndices[i]
+				break
+			}
+		}
+		if got == nil {
+			diffs = append(diffs, fmt.Sprintf("index %s: отсутствует", want.Name))
+			continue
+		}
+		if want.Type != "" {
+			gotType := got.Type
+			if strings.Contains(want.Type, "(") {
+				// тип с аргументами сравниваем по DDL (в system.data_skipping_indices аргументов нет)
+				if idx := s.DDL.Index(want.Name); idx != nil {
+					gotType = idx.Type
+				}
+			}
+			if ddl.Normalize(gotType) != ddl.Normalize(want.Type) {
+				diffs = append(diffs, fmt.Sprintf("index %s: type %s, ожидается %s", want.Name, gotType, want.Type))
+			}
+		}
+		if want.Expr != "" && ddl.Normalize(got.Expr) != ddl.Normalize(want.Expr) {
+			diffs = append(diffs, fmt.Sprintf("index %s: expr %s, ожидается %s", want.Name, got.Expr, want.Expr))
+		}
+		if want.Granularity > 0 && got.Granularity != uint64(want.Granularity) {
+			diffs = append(diffs, fmt.Sprintf("index %s: granularity %d, ожидается %d", want.Name, got.Granularity, want.Granularity))
+		}
+	}
+
+	for _, name := range spec.Projections {
+		if s.DDL.Projection(name) == nil {
+			diffs = append(diffs, fmt.Sprintf("projection %s: отсутствует", name))
+		}
+	}
+
+	diffs = appendExprDiff(diffs, "order_by", s.SortingKey, spec.OrderBy)
+	diffs = appendExprDiff(diffs, "primary_key", s.PrimaryKey, spec.PrimaryKey)
+	diffs = appendExprDiff(diffs, "partition_by", s.PartitionKey, spec.PartitionBy)
+	diffs = appendExprDiff(diffs, "ttl", s.DDL.TTL, spec.TTL)
+
+	if spec.IndexGranularity > 0 {
+		got := 8192 // значение по умолчанию, если в SETTINGS не указано
+		if v, ok := s.DDL.Settings["index_granularity"]; ok {
+			got, _ = strconv.Atoi(v)
+		}
+		if got != spec.IndexGranularity {
+			diffs = append(diffs, fmt.Sprintf("index_granularity: %d, ожидается %d", got, spec.IndexGranularity))
+		}
+	}
+
+	columns := make([]string, 0, len(spec.Codecs))
+	for col := range spec.Codecs {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+	for _, col := range columns {
+		want := ddl.NormalizeCodec(spec.Codecs[col])
+		var got *chclient.ColumnInfo
+		for i := range s.Columns {
+			if s.Columns[i].Name == col {
+				got = &s.Columns[i]
+				break
+			}
+		}
+		if got == nil {
+			diffs = append(diffs, fmt.Sprintf("column %s: отсутствует", col))
+			continue
+		}
+		if !ddl.CodecsEqual(got.Codec, want) {
+			diffs = append(diffs, fmt.Sprintf("column %s: codec %s, ожидается %s", col, orNone(got.Codec), orNone(want)))
+		}
+	}
+	return diffs
+}
+
+// appendExprDiff добавляет расхождение, если ожидание задано и нормализованные выражения различаются.
+func appendExprDiff(diffs []string, what, got, want string) []string {
+	if want == "" || ddl.Normalize(got) == ddl.Normalize(want) {
+		return diffs
+	}
+	return append(diffs, fmt.Sprintf("%s: %s, ожидается %s", what, orNone(got), want))
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(нет)"
+	}
+	return s
+}
+
+// canonicalReference переформатирует эталон сервером, чтобы выражения (TTL, DEFAULT, ключи, проекции)
+// были записаны так же, как в create_table_query. При ошибке возвращает эталон как есть вместе с ошибкой.
+func canonicalReference(ctx context.Context, client chclient.Client, ref *ddl.Table) (*ddl.Table, error) {
+	formatted, err := client.FormatQuery(ctx, ref.Source)
+	if err != nil {
+		return ref, err
+	}
+	parsed, err := ddl.ParseCreateTable(formatted)
+	if err != nil {
+		return ref, fmt.Errorf("parse formatted reference: %w", err)
+	}
+	return parsed, nil
+}
+
+// compareDDL сравнивает таблицу с эталонным CREATE TABLE: колонки (тип, кодек, DEFAULT), индексы, проекции,
+// ORDER BY, PARTITION BY, PRIMARY KEY, TTL и SETTINGS. Каждое отличие — отдельная строка.
+func compareDDL(ref *ddl.Table, s *chclient.TableSchema) []string {
+	var diffs []string
+	live := s.DDL
+
+	liveCols := make(map[string]chclient.ColumnInfo, len(s.Columns))
+	for _, c := range s.Columns {
+		liveCols[c.Name] = c
+	}
+	refCols := make(map[string]bool, len(ref.Columns))
+	for _, rc := range ref.Columns {
+		refCols[rc.Name] = true
+		lc, ok := liveCols[rc.Name]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("column %s: отсутствует в таблице", rc.Name))
+			continue
+		}
+		if ddl.Normalize(lc.Type) != ddl.Normalize(rc.Type) {
+			diffs = append(diffs, fmt.Sprintf("column %s: type %s, в эталоне %s", rc.Name, lc.Type, rc.Type))
+		}
+		if !ddl.CodecsEqual(lc.Codec, rc.Codec) {
+			diffs = append(diffs, fmt.Sprintf("column %s: codec %s, в эталоне %s", rc.Name, orNone(lc.Codec), orNone(rc.Codec)))
+		}
+		if !strings.EqualFold(lc.DefaultKind, rc.DefaultKind) || ddl.Normalize(lc.DefaultExpr) != rc.DefaultExpr {
+			diffs = append(diffs, fmt.Sprintf("column %s: default %s, в эталоне %s",
+				rc.Name, orNone(strings.TrimSpace(lc.DefaultKind+" "+lc.DefaultExpr)), orNone(strings.TrimSpace(rc.DefaultKind+" "+rc.DefaultExpr))))
+		}
+	}
+	for _, lc := range s.Columns {
+		if !refCols[lc.Name] {
+			diffs = append(diffs, fmt.Sprintf("column %s: нет в эталоне", lc.Name))
+		}
+	}
+
+	for _, ri := range ref.Indexes {
+		li := live.Index(ri.Name)
+		if li == nil {
+			diffs = append(diffs, fmt.Sprintf("index %s: отсутствует в таблице", ri.Name))
+			continue
+		}
+		if li.Expr != ri.Expr {
+			diffs = append(diffs, fmt.Sprintf("index %s: expr %s, в эталоне %s", ri.Name, li.Expr, ri.Expr))
+		}
+		if li.Type != ri.Type {
+			diffs = append(diffs, fmt.Sprintf("index %s: type %s, в эталоне %s", ri.Name, li.Type, ri.Type))
+		}
+		if li.Granularity != ri.Granularity {
+			diffs = append(diffs, fmt.Sprintf("index %s: granularity %d, в эталоне %d", ri.Name, li.Granularity, ri.Granularity))
+		}
+	}
+	for _, li := range live.Indexes {
+		if ref.Index(li.Name) == nil {
+			diffs = append(diffs, fmt.Sprintf("index %s: нет в эталоне", li.Name))
+		}
+	}
+
+	for _, rp := range ref.Projections {
+		lp := live.Projection(rp.Name)
+		if lp == nil {
+			diffs = append(diffs, fmt.Sprintf("projection %s: отсутствует в таблице", rp.Name))
+			continue
+		}
+		if !strings.EqualFold(lp.Query, rp.Query) {
+			diffs = append(diffs, fmt.Sprintf("projection %s: запрос отличается: %s, в эталоне %s", rp.Name, lp.Query, rp.Query))
+		}
+	}
+	for _, lp := range live.Projections {
+		if ref.Projection(lp.Name) == nil {
+			diffs = append(diffs, fmt.Sprintf("projection %s: нет в эталоне", lp.Name))
+		}
+	}
+
+	diffs = appendRefExprDiff(diffs, "order_by", s.SortingKey, ref.OrderBy)
+	diffs = appendRefExprDiff(diffs, "partition_by", s.PartitionKey, ref.PartitionBy)
+	if ref.PrimaryKey != "" {
+		// без PRIMARY KEY в DDL первичный ключ совпадает с ORDER BY — сравнивать нечего
+		diffs = appendRefExprDiff(diffs, "primary_key", s.PrimaryKey, ref.PrimaryKey)
+	}
+	diffs = appendRefExprDiff(diffs, "ttl", live.TTL, ref.TTL)
+
+	keys := make(map[string]bool)
+	for k := range ref.Settings {
+		keys[k] = true
+	}
+	for k := range live.Settings {
+		keys[k] = true
+	}
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		rv, inRef := ref.Settings[k]
+		lv, inLive := live.Settings[k]
+		switch {
+		case inRef && inLive && rv != lv:
+			diffs = append(diffs, fmt.Sprintf("setting %s: %s, в эталоне %s", k, lv, rv))
+		case inRef && !inLive:
+			diffs = append(diffs, fmt.Sprintf("setting %s: не задан, в эталоне %s", k, rv))
+		case !inRef && inLive && !(k == "index_granularity" && lv == "8192"):
+			// index_granularity = 8192 ClickHouse дописывает в SHOW CREATE сам
+			diffs = append(diffs, fmt.Sprintf("setting %s: %s, нет в эталоне", k, lv))
+		}
+	}
+	return diffs
+}
+
+// appendRefExprDiff — как appendExprDiff, но сравнивает и пустые значения (в эталоне не задано, а в таблице есть).
+func appendRefExprDiff(diffs []string, what, got, ref string) []string {
+	if ddl.Normalize(got) == ddl.Normalize(ref) {
+		return diffs
+	}
+	return append(diffs, fmt.Sprintf("%s: %s, в эталоне %s", what, orNone(got), orNone(ref)))
+}
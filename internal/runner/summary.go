@@ -0,0 +1,41 @@
+// Package runner — сводная статистика по повторным замерам запроса (iterations).
+package runner
+
+import (
+	"math"
+	"sort"
+
+	"clicktester/internal/tests"
+)
+
+// summarize считает min/median/p95/max и стандартное отклонение по выборке замеров.
+func summarize(samples []float64) *tests.MetricSummary {
+	n := len(samples)
+	if n == 0 {
+		return nil
+	}
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	mean := sum / float64(n)
+	var sq float64
+	for _, v := range sorted {
+		sq += (v - mean) * (v - mean)
+	}
+
+	median := sorted[n/2]
+	if n%2 == 0 {
+		median = (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	return &tests.MetricSummary{
+		Min:    sorted[0],
+		Median: median,
+		P95:    percentile(sorted, n, 95),
+		Max:    sorted[n-1],
+		Stddev: math.Sqrt(sq / float64(n)),
+	}
+}
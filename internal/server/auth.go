@@ -0,0 +1,122 @@
+// Package server — аутентификация -serve (Basic и Bearer) и роль только для чтения.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"clicktester/internal/config"
+)
+
+// principal — аутентифицированный пользователь или токен.
+type principal struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type principalKey struct{}
+
+// withAuth проверяет Authorization (Bearer — tokens, Basic — users) и роль: viewer допускается только
+// к чтению (GET/HEAD), запуск и остановка прогонов требуют admin. Без users и tokens сервер открыт.
+func withAuth(auth config.ServerAuth, next http.Handler) http.Handler {
+	if !auth.Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := authenticate(auth, r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="clicktester", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if p.Role != config.RoleAdmin && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "forbidden: role "+p.Role+" is read-only", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	})
+}
+
+// rejectCrossSite отклоняет изменяющие запросы, которые браузер мог отправить со страницы другого сайта:
+// обычная <form method=post> пришла бы с сохранёнными Basic-учётными данными (а без auth — вообще без них)
+// и запустила бы прогон или стресс-тест. POST должен идти с Content-Type: application/json — такой запрос
+// с чужого origin браузер без CORS preflight не отправит, а preflight сервер не разрешает.
+// Заголовки Sec-Fetch-Site и Origin, если есть, должны указывать на этот же сервер.
+func rejectCrossSite(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" && site != "none" {
+			http.Error(w, "forbidden: cross-site request", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				http.Error(w, "forbidden: cross-origin request", http.StatusForbidden)
+				return
+			}
+		}
+		if r.Method == http.MethodPost {
+			if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+				http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate ищет пользователя по заголовку Authorization; секреты сравниваются за постоянное время.
+func authenticate(auth config.ServerAuth, r *http.Request) (principal, bool) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		for _, t := range auth.Tokens {
+			if secretEqual(token, t.Token) {
+				return principal{Name: t.Name, Role: t.Role}, true
+			}
+		}
+		return principal{}, false
+	}
+	if name, password, ok := r.BasicAuth(); ok {
+		for _, u := range auth.Users {
+			if secretEqual(name, u.Name) && secretEqual(password, u.Password) {
+				return principal{Name: u.Name, Role: u.Role}, true
+			}
+		}
+	}
+	return principal{}, false
+}
+
+func secretEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// serveMe отвечает на GET /api/me: кто вошёл и с какой ролью (UI скрывает кнопки запуска для viewer).
+func serveMe(w http.ResponseWriter, r *http.Request) {
+	p, ok := r.Context().Value(principalKey{}).(principal)
+	if !ok {
+		p = principal{Role: config.RoleAdmin} // аутентификация выключена
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// isLoopback сообщает, слушает ли addr только локальный интерфейс.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,90 @@
+// Package server — журнал событий для Server-Sent Events (прогоны и стресс-тесты).
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// eventDone — последнее событие журнала: после него поток SSE закрывается.
+const eventDone = "done"
+
+// event — событие SSE: имя и данные (сериализуются в JSON).
+type event struct {
+	Name string
+	Data any
+}
+
+// eventLog — журнал событий, хранится целиком, чтобы подписчик, подключившийся позже, получил всё с начала.
+type eventLog struct {
+	mu      sync.Mutex
+	events  []event
+	changed chan struct{} // закрывается и пересоздаётся при каждом новом событии
+}
+
+func newEventLog() *eventLog {
+	return &eventLog{changed: make(chan struct{})}
+}
+
+func (l *eventLog) append(name string, data any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event{Name: name, Data: data})
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// serve отдаёт журнал как text/event-stream до события done или отключения клиента.
+func (l *eventLog) serve(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sent := 0
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		l.mu.Lock()
+		pending := l.events[sent:]
+		changed := l.changed
+		l.mu.Unlock()
+
+		for _, ev := range pending {
+			data, err := json.Marshal(ev.Data)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Name, data); err != nil {
+				return
+			}
+			sent++
+			if ev.Name == eventDone {
+				flusher.Flush()
+				return
+			}
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		case <-keepAlive.C:
+			// комментарий SSE, чтобы прокси не закрывали соединение на долгих запросах
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
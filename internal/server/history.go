@@ -0,0 +1,146 @@
+// Package server — история прогонов: каждый завершённый прогон сохраняется в каталог как JSON-экспорт отчёта.
+package server
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"clicktester/internal/report"
+	"clicktester/internal/tests"
+)
+
+// RunSummary — прогон в списке GET /api/runs (без результатов задач).
+type RunSummary struct {
+	ID          string `json:"id"`
+	Status      string `json:"status"`
+	GeneratedAt string `json:"generated_at,omitempty"` // время формирования отчёта; пусто, пока прогон выполняется
+	Host        string `json:"host,omitempty"`
+	Database    string `json:"database,omitempty"`
+	Table       string `json:"table,omitempty"`
+	Total       int    `json:"total"`
+	Passed      int    `json:"passed"`
+	Failed      int    `json:"failed"`
+	Cancelled   int    `json:"cancelled"`
+}
+
+// runIDPattern — допустимые ID прогонов (ID — имя файла в каталоге истории, без путей).
+var runIDPattern = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+
+// history — каталог с JSON-отчётами прогонов (<id>.json) и индекс в памяти для списка.
+type history struct {
+	dir  string
+	mu   sync.Mutex
+	runs map[string]RunSummary
+}
+
+// openHistory создаёт каталог истории (если нет) и читает уже сохранённые прогоны.
+// Нечитаемые файлы пропускаются с предупреждением в лог.
+func openHistory(dir string) (*history, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("history dir: %w", err)
+	}
+	h := &history{dir: dir, runs: make(map[string]RunSummary)}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("history dir: %w", err)
+	}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if e.IsDir() || !ok || !runIDPattern.MatchString(id) {
+			continue
+		}
+		data, err := report.ReadJSON(filepath.Join(dir, e.Name()))
+		if err != nil {
+			log.Printf("[clicktester] history: %v", err)
+			continue
+		}
+		h.runs[id] = summaryOf(id, data)
+	}
+	return h, nil
+}
+
+// summaryOf — строка списка по сохранённому отчёту.
+func summaryOf(id string, d *report.ExportData) RunSummary {
+	status := JobDone
+	if d.Cancelled > 0 {
+		status = JobCancelled
+	}
+	return RunSummary{
+		ID:          id,
+		Status:      status,
+		GeneratedAt: d.Meta.GeneratedAt,
+		Host:        d.Meta.Host,
+		Database:    d.Meta.Database,
+		Table:       d.Meta.Table,
+		Total:       d.Total,
+		Passed:      d.Passed,
+		Failed:      d.Failed,
+		Cancelled:   d.Cancelled,
+	}
+}
+
+func (h *history) path(id string) (string, error) {
+	if !runIDPattern.MatchString(id) {
+		return "", fmt.Errorf("invalid run id %q", id)
+	}
+	return filepath.Join(h.dir, id+".json"), nil
+}
+
+// save записывает прогон в историю в формате report.WriteJSON.
+func (h *history) save(id string, r *tests.RunResult, meta *report.ReportMeta) error {
+	path, err := h.path(id)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteJSON(path, r, meta); err != nil {
+		return fmt.Errorf("save run %s: %w", id, err)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.runs[id] = summaryOf(id, &report.ExportData{
+		Meta:      *meta,
+		Total:     r.Total,
+		Passed:    r.Passed,
+		Failed:    r.Failed,
+		Cancelled: r.Cancelled,
+	})
+	return nil
+}
+
+// has сообщает, есть ли прогон в истории.
+func (h *history) has(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.runs[id]
+	return ok
+}
+
+// load читает сохранённый прогон.
+func (h *history) load(id string) (*report.ExportData, error) {
+	if !h.has(id) {
+		return nil, os.ErrNotExist
+	}
+	path, err := h.path(id)
+	if err != nil {
+		return nil, err
+	}
+	return report.ReadJSON(path)
+}
+
+// list возвращает сохранённые прогоны, новые первыми (ID начинается со времени запуска).
+func (h *history) list() []RunSummary {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]RunSummary, 0, len(h.runs))
+	for _, s := range h.runs {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].ID > out[k].ID })
+	return out
+}
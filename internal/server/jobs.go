@@ -0,0 +1,271 @@
+// Package server — асинхронные прогоны (jobs): запуск в фоне, результаты по мере выполнения через SSE.
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+
+	"clicktester/internal/chclient"
+	"clicktester/internal/report"
+	"clicktester/internal/runner"
+	"clicktester/internal/tests"
+)
+
+// Статусы прогона.
+const (
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// JobProgress — прогресс прогона.
+type JobProgress struct {
+	Done      int `json:"done"`
+	Total     int `json:"total"`
+	Passed    int `json:"passed"`
+	Failed    int `json:"failed"`
+	Cancelled int `json:"cancelled"`
+}
+
+// JobInfo — состояние прогона для API (GET /api/runs/{id}).
+type JobInfo struct {
+	ID         string             `json:"id"`
+	Status     string             `json:"status"`
+	StartedAt  time.Time          `json:"started_at"`
+	FinishedAt *time.Time         `json:"finished_at,omitempty"`
+	Progress   JobProgress        `json:"progress"`
+	Error      string             `json:"error,omitempty"`
+	Results    []tests.TestResult `json:"results"` // в порядке завершения (до окончания) или в порядке задач
+}
+
+// resultEvent — данные события result.
+type resultEvent struct {
+	Result   tests.TestResult `json:"result"`
+	Progress JobProgress      `json:"progress"`
+}
+
+// doneEvent — данные события done.
+type doneEvent struct {
+	Status   string      `json:"status"`
+	Error    string      `json:"error,omitempty"`
+	Progress JobProgress `json:"progress"`
+}
+
+// job — один прогон, запущенный через API.
+type job struct {
+	mu         sync.Mutex
+	id         string
+	status     string
+	startedAt  time.Time
+	finishedAt time.Time
+	progress   JobProgress
+	results    []tests.TestResult
+	final      *tests.RunResult
+	err        string
+	events     *eventLog // result на каждую задачу, в конце done
+
+	client    chclient.Client
+	tracker   *chclient.QueryTracker // query_id выполняющихся запросов — для KILL QUERY при отмене
+	cancelRun context.CancelFunc
+	cancelled bool
+	ran       bool          // RunWithProgress вернулся: отменять уже нечего
+	aborted   chan struct{} // закрывается, когда KILL QUERY после отмены выполнен
+	abortErr  error         // ошибка KILL QUERY — в предупреждения отчёта
+}
+
+func (j *job) info() JobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info := JobInfo{ID: j.id, Status: j.status, StartedAt: j.startedAt, Progress: j.progress, Error: j.err}
+	if !j.finishedAt.IsZero() {
+		t := j.finishedAt
+		info.FinishedAt = &t
+	}
+	if j.final != nil {
+		info.Results = j.final.Results
+	} else {
+		info.Results = append([]tests.TestResult{}, j.results...)
+	}
+	return info
+}
+
+// jobManager — выполняющиеся прогоны, запущенные через API. Завершённый прогон сохраняется в историю
+// и удаляется из памяти: дальше его отдают из истории (см. historyInfo, historyEvents).
+type jobManager struct {
+	mu      sync.Mutex
+	jobs    map[string]*job
+	history *history
+	meta    func() *report.ReportMeta // метаданные отчёта для сохранения в историю
+}
+
+func newJobManager(hist *history, meta func() *report.ReportMeta) *jobManager {
+	return &jobManager{jobs: make(map[string]*job), history: hist, meta: meta}
+}
+
+// running возвращает выполняющиеся прогоны (завершённые уже есть в истории).
+func (m *jobManager) running() []RunSummary {
+	m.mu.Lock()
+	jobs := make([]*job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, j)
+	}
+	m.mu.Unlock()
+
+	var out []RunSummary
+	for _, j := range jobs {
+		info := j.info()
+		if info.Status != JobRunning {
+			continue
+		}
+		out = append(out, RunSummary{
+			ID:        info.ID,
+			Status:    info.Status,
+			Total:     info.Progress.Total,
+			Passed:    info.Progress.Passed,
+			Failed:    info.Progress.Failed,
+			Cancelled: info.Progress.Cancelled,
+		})
+	}
+	return out
+}
+
+func (m *jobManager) get(id string) *job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.jobs[id]
+}
+
+func (m *jobManager) forget(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.jobs, id)
+}
+
+// start запускает задачи в фоне и сразу возвращает прогон.
+func (m *jobManager) start(ctx context.Context, tasks []tests.Task, workers int, client chclient.Client, queryTimeout time.Duration) *job {
+	runCtx, cancel := context.WithCancel(ctx)
+	runCtx, tracker := chclient.WithQueryTracker(runCtx)
+	j := &job{
+		id:        newJobID(),
+		status:    JobRunning,
+		startedAt: time.Now(),
+		progress:  JobProgress{Total: len(tasks)},
+		events:    newEventLog(),
+		client:    client,
+		tracker:   tracker,
+		cancelRun: cancel,
+	}
+	m.mu.Lock()
+	m.jobs[j.id] = j
+	m.mu.Unlock()
+
+	go func() {
+		// уже подключённые подписчики держат j и дочитают журнал до done
+		defer m.forget(j.id)
+		defer cancel()
+		result, err := runner.RunWithProgress(runCtx, tasks, workers, client, queryTimeout, func(res tests.TestResult) {
+			j.mu.Lock()
+			defer j.mu.Unlock()
+			j.results = append(j.results, res)
+			j.progress.Done++
+			switch {
+			case res.Pass:
+				j.progress.Passed++
+			case res.Cancelled:
+				j.progress.Cancelled++
+			default:
+				j.progress.Failed++
+			}
+			j.events.append("result", resultEvent{Result: res, Progress: j.progress})
+		})
+		j.mu.Lock()
+		j.ran = true
+		aborted := j.aborted
+		j.mu.Unlock()
+		var abortErr error
+		if aborted != nil {
+			<-aborted
+			j.mu.Lock()
+			abortErr = j.abortErr
+			j.mu.Unlock()
+		}
+		// сохраняем до события done, чтобы клиент после done уже видел прогон в истории
+		if result != nil {
+			meta := m.meta()
+			if abortErr != nil {
+				meta.Warnings = append(meta.Warnings, runner.AbortWarning(abortErr))
+			}
+			if err := m.history.save(j.id, result, meta); err != nil {
+				log.Printf("[clicktester] %v", err)
+			}
+		}
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		j.finishedAt = time.Now()
+		j.status = JobDone
+		if j.cancelled {
+			j.status = JobCancelled
+		}
+		if err != nil {
+			j.status = JobFailed
+			j.err = err.Error()
+		}
+		j.final = result
+		j.events.append(eventDone, doneEvent{j.status, j.err, j.progress})
+	}()
+	return j
+}
+
+// cancel отменяет прогон и останавливает его запросы на сервере (KILL QUERY).
+// Возвращает false, если прогон уже завершён (в том числе если задачи выполнены, а результат ещё сохраняется).
+func (j *job) cancel() (bool, error) {
+	j.mu.Lock()
+	if j.status != JobRunning || j.cancelled || j.ran {
+		j.mu.Unlock()
+		return false, nil
+	}
+	j.cancelled = true
+	j.aborted = make(chan struct{})
+	j.mu.Unlock()
+	err := runner.Abort(j.cancelRun, j.tracker, j.client)
+	j.mu.Lock()
+	j.abortErr = err
+	j.mu.Unlock()
+	close(j.aborted)
+	return true, err
+}
+
+// historyEvents — журнал событий завершённого прогона, восстановленный из истории: result на каждую задачу и done.
+func historyEvents(info JobInfo) *eventLog {
+	l := newEventLog()
+	p := JobProgress{Total: info.Progress.Total}
+	for _, res := range info.Results {
+		p.Done++
+		switch {
+		case res.Pass:
+			p.Passed++
+		case res.Cancelled:
+			p.Cancelled++
+		default:
+			p.Failed++
+		}
+		l.append("result", resultEvent{Result: res, Progress: p})
+	}
+	l.append(eventDone, doneEvent{info.Status, info.Error, info.Progress})
+	return l
+}
+
+// jobIDTimeLayout — формат времени запуска в начале ID прогона.
+const jobIDTimeLayout = "20060102-150405"
+
+// newJobID — ID прогона: время запуска + случайный суффикс (сортируется по времени).
+func newJobID() string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+	return time.Now().Format(jobIDTimeLayout) + "-" + hex.EncodeToString(b)
+}
@@ -3,16 +3,20 @@ package server
 
 import (
 	_ "embed"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"os/exec"
 	"runtime"
-	"strconv"
+	"sort"
 	"time"
 
 	"clicktester/internal/chclient"
 	"clicktester/internal/config"
+	"clicktester/internal/report"
 	"clicktester/internal/runner"
 	"clicktester/internal/tests"
 )
@@ -34,19 +38,26 @@ type RunRequest struct {
 	TaskIDs []int `json:"taskIDs"`
 }
 
-// Run запускает HTTP-сервер на port, открывает браузер по baseURL (например http://localhost:8080).
+// Run запускает HTTP-сервер на addr (например 127.0.0.1:8080 или :8080), открывает браузер по baseURL.
+// При заданных server.auth.users/tokens все запросы требуют аутентификации.
+// Стресс-тесты открывают своё подключение по connOpts с пулом под число одновременных запросов теста.
 // Блокирует до остановки сервера (Shutdown или прерывание).
-func Run(ctx context.Context, cfg *config.Config, taskList []tests.Task, client chclient.Client, port int, baseURL string) error {
+func Run(ctx context.Context, cfg *config.Config, taskList []tests.Task, client chclient.Client, connOpts chclient.ConnectOptions, addr string, baseURL string) error {
 	queryTimeout := time.Duration(cfg.Execution.QueryTimeoutSec) * time.Second
 	workers := cfg.Execution.Workers
 	if workers < 1 {
 		workers = 1
 	}
-	if port <= 0 {
-		port = 8080
+	srv := &http.Server{Addr: addr, Handler: rejectCrossSite(withAuth(cfg.Server.Auth, http.DefaultServeMux))}
+	if !cfg.Server.Auth.Enabled() && !isLoopback(addr) {
+		log.Printf("[clicktester] warning: server listens on %s without authentication; anyone with network access can run queries (set server.auth or -listen 127.0.0.1:PORT)", addr)
 	}
-	addr := ":" + strconv.Itoa(port)
-	srv := &http.Server{Addr: addr}
+
+	hist, err := openHistory(cfg.Server.HistoryDir)
+	if err != nil {
+		return err
+	}
+	meta := func() *report.ReportMeta { return reportMeta(cfg) }
 
 	// Маршруты
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -57,6 +68,7 @@ func Run(ctx context.Context, cfg *config.Config, taskList []tests.Task, client
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.Write(indexHTML)
 	})
+	http.HandleFunc("GET /api/me", serveMe)
 	http.HandleFunc("/api/tasks", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -79,19 +91,7 @@ func Run(ctx context.Context, cfg *config.Config, taskList []tests.Task, client
 			http.Error(w, "invalid json: "+err.Error(), http.StatusBadRequest)
 			return
 		}
-		tasksToRun := taskList
-		if len(req.TaskIDs) > 0 {
-			idSet := make(map[int]bool)
-			for _, id := range req.TaskIDs {
-				idSet[id] = true
-			}
-			tasksToRun = make([]tests.Task, 0, len(req.TaskIDs))
-			for _, t := range taskList {
-				if idSet[t.ID] {
-					tasksToRun = append(tasksToRun, t)
-				}
-			}
-		}
+		tasksToRun := selectTasks(taskList, req.TaskIDs)
 		if len(tasksToRun) == 0 {
 			w.Header().Set("Content-Type", "application/json")
 			_ = json.NewEncoder(w).Encode(&tests.RunResult{})
@@ -102,15 +102,293 @@ func Run(ctx context.Context, cfg *config.Config, taskList []tests.Task, client
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		id := newJobID()
+		if err := hist.save(id, result, meta()); err != nil {
+			log.Printf("[clicktester] %v", err)
+		} else {
+			w.Header().Set("Location", "/api/runs/"+id)
+		}
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		_ = json.NewEncoder(w).Encode(result)
 	})
 
+	// Асинхронные прогоны: POST /api/runs возвращает ID сразу, результаты — через GET /api/runs/{id}/events (SSE).
+	jobs := newJobManager(hist, meta)
+	http.HandleFunc("GET /api/runs", func(w http.ResponseWriter, r *http.Request) {
+		list := append(hist.list(), jobs.running()...)
+		sort.SliceStable(list, func(i, k int) bool { return list[i].ID > list[k].ID })
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(list)
+	})
+	http.HandleFunc("POST /api/runs", func(w http.ResponseWriter, r *http.Request) {
+		var req RunRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid json: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		tasksToRun := selectTasks(taskList, req.TaskIDs)
+		if len(tasksToRun) == 0 {
+			http.Error(w, "no tasks to run", http.StatusBadRequest)
+			return
+		}
+		j := jobs.start(ctx, tasksToRun, workers, client, queryTimeout)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(j.info())
+	})
+	http.HandleFunc("GET /api/runs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		// из памяти — только выполняющийся прогон; завершённый (в том числе ещё не удалённый из памяти) — из истории
+		var info JobInfo
+		if j := jobs.get(id); j != nil {
+			info = j.info()
+		}
+		if info.Status != JobRunning {
+			data, err := hist.load(id)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			info = historyInfo(id, data)
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(info)
+	})
+	// Отчёты по сохранённому прогону: HTML генерируется заново из JSON, JSON отдаётся файлом.
+	http.HandleFunc("GET /api/runs/{id}/report.html", func(w http.ResponseWriter, r *http.Request) {
+		data, err := hist.load(r.PathValue("id"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		var buf bytes.Buffer
+		if err := report.RenderHTML(&buf, data.RunResult(), &data.Meta); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(buf.Bytes())
+	})
+	http.HandleFunc("GET /api/runs/{id}/report.json", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		path, err := hist.path(id)
+		if err != nil || !hist.has(id) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="clicktester-`+id+`.json"`)
+		http.ServeFile(w, r, path)
+	})
+	http.HandleFunc("DELETE /api/runs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		j := jobs.get(id)
+		if j == nil {
+			if hist.has(id) {
+				http.Error(w, "run is not running", http.StatusConflict)
+				return
+			}
+			http.NotFound(w, r)
+			return
+		}
+		ok, err := j.cancel()
+		if !ok {
+			http.Error(w, "run is not running", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			// контекст уже отменён, незапущенные задачи будут помечены cancelled; KILL QUERY мог не пройти
+			log.Printf("[clicktester] run %s: %v", j.id, err)
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(j.info())
+	})
+	http.HandleFunc("GET /api/runs/{id}/events", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if j := jobs.get(id); j != nil {
+			j.events.serve(w, r)
+			return
+		}
+		// прогон завершён и удалён из памяти — журнал восстанавливается из истории
+		data, err := hist.load(id)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		historyEvents(historyInfo(id, data)).serve(w, r)
+	})
+
+	// Стресс-тест: POST /api/stress запускает, GET /api/stress/{id}/events — метрики по секундам (SSE).
+	stress := newStressManager()
+	http.HandleFunc("GET /api/stress", func(w http.ResponseWriter, r *http.Request) {
+		ov := StressOverview{Templates: make([]string, 0, len(cfg.QueryTemplates)), Defaults: stressDefaults(cfg), Current: stress.running()}
+		for _, qt := range cfg.QueryTemplates {
+			ov.Templates = append(ov.Templates, qt.Name)
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(ov)
+	})
+	http.HandleFunc("POST /api/stress", func(w http.ResponseWriter, r *http.Request) {
+		var p StressParams
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+				http.Error(w, "invalid json: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		j, err := stress.start(ctx, cfg, p, connOpts, queryTimeout)
+		if errors.Is(err, errStressRunning) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(j.info())
+	})
+	http.HandleFunc("GET /api/stress/{id}", func(w http.ResponseWriter, r *http.Request) {
+		j := stress.get(r.PathValue("id"))
+		if j == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(j.info())
+	})
+	http.HandleFunc("GET /api/stress/{id}/result.json", func(w http.ResponseWriter, r *http.Request) {
+		j := stress.get(r.PathValue("id"))
+		if j == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="clicktester-stress-`+j.id+`.json"`)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(j.info())
+	})
+	// Отчёт стресс-теста как у -stress (HTML с графиками или JSON); доступен после завершения теста.
+	for _, format := range []string{"html", "json"} {
+		http.HandleFunc("GET /api/stress/{id}/report."+format, func(w http.ResponseWriter, r *http.Request) {
+			j := stress.get(r.PathValue("id"))
+			if j == nil {
+				http.NotFound(w, r)
+				return
+			}
+			stressCfg, res, warnings := j.reportResult()
+			if res == nil {
+				http.Error(w, "stress test is still running", http.StatusConflict)
+				return
+			}
+			meta := reportMeta(cfg)
+			meta.Workers = stressCfg.Workers
+			meta.Warnings = warnings
+			if format == "json" {
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.Header().Set("Content-Disposition", `attachment; filename="clicktester-stress-report-`+j.id+`.json"`)
+				enc := json.NewEncoder(w)
+				enc.SetIndent("", "  ")
+				_ = enc.Encode(report.StressExport{Meta: *meta, Config: stressCfg, Result: res})
+				return
+			}
+			var buf bytes.Buffer
+			if err := report.RenderStressHTML(&buf, stressCfg, res, meta); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write(buf.Bytes())
+		})
+	}
+	http.HandleFunc("DELETE /api/stress/{id}", func(w http.ResponseWriter, r *http.Request) {
+		j := stress.get(r.PathValue("id"))
+		if j == nil {
+			http.NotFound(w, r)
+			return
+		}
+		ok, err := j.stop()
+		if !ok {
+			http.Error(w, "stress test is not running", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("[clicktester] stress %s: %v", j.id, err)
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(j.info())
+	})
+	http.HandleFunc("GET /api/stress/{id}/events", func(w http.ResponseWriter, r *http.Request) {
+		j := stress.get(r.PathValue("id"))
+		if j == nil {
+			http.NotFound(w, r)
+			return
+		}
+		j.events.serve(w, r)
+	})
+
 	go openBrowser(baseURL)
 
 	return srv.ListenAndServe()
 }
 
+// reportMeta — метаданные отчёта прогона из конфига (как у отчёта, который пишет CLI).
+func reportMeta(cfg *config.Config) *report.ReportMeta {
+	return &report.ReportMeta{
+		GeneratedAt:  time.Now().Format("2006-01-02 15:04:05"),
+		Host:         cfg.ClickHouse.Host,
+		Database:     cfg.ClickHouse.Database,
+		Table:        cfg.ClickHouse.TableName,
+		Workers:      cfg.Execution.Workers,
+		GranulesWarn: cfg.Report.Thresholds.GranulesWarn,
+		GranulesFail: cfg.Report.Thresholds.GranulesFail,
+		ReadRowsWarn: cfg.Report.Thresholds.ReadRowsWarn,
+	}
+}
+
+// historyInfo — состояние завершённого прогона из истории в формате GET /api/runs/{id}.
+func historyInfo(id string, d *report.ExportData) JobInfo {
+	s := summaryOf(id, d)
+	info := JobInfo{
+		ID:       id,
+		Status:   s.Status,
+		Progress: JobProgress{Done: d.Total, Total: d.Total, Passed: d.Passed, Failed: d.Failed, Cancelled: d.Cancelled},
+		Results:  d.Results,
+	}
+	if len(id) >= len(jobIDTimeLayout) {
+		if t, err := time.ParseInLocation(jobIDTimeLayout, id[:len(jobIDTimeLayout)], time.Local); err == nil {
+			info.StartedAt = t
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", d.Meta.GeneratedAt, time.Local); err == nil {
+		info.FinishedAt = &t
+	}
+	return info
+}
+
+// selectTasks возвращает задачи с указанными ID (пустой список — все задачи).
+func selectTasks(taskList []tests.Task, ids []int) []tests.Task {
+	if len(ids) == 0 {
+		return taskList
+	}
+	idSet := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		idSet[id] = true
+	}
+	out := make([]tests.Task, 0, len(ids))
+	for _, t := range taskList {
+		if idSet[t.ID] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
 func openBrowser(url string) {
 	// Небольшая задержка, чтобы сервер успел подняться.
 	time.Sleep(500 * time.Millisecond)
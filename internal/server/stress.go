@@ -0,0 +1,376 @@
+// Package server — стресс-тест из веб-интерфейса: запуск в фоне, метрики по секундам через SSE, остановка.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"clicktester/internal/chclient"
+	"clicktester/internal/config"
+	"clicktester/internal/report"
+	"clicktester/internal/runner"
+)
+
+// Ограничения параметров стресс-теста из API.
+const (
+	maxStressWorkers     = 1000 // и max_in_flight: пул подключения теста открывается под пик воркеров
+	maxStressDurationSec = 24 * 60 * 60
+	maxStressQPS         = 10000
+
+	// maxFinishedStressJobs — сколько завершённых стресс-тестов держать в памяти для GET /api/stress/{id}
+	// и отчётов; более старые удаляются (ряд по секундам суточного теста занимает десятки мегабайт).
+	maxFinishedStressJobs = 10
+)
+
+// StressParams — параметры запуска стресс-теста (тело POST /api/stress); незаданные берутся из stress_test.
+type StressParams struct {
+	QueryName   string  `json:"query_name"`
+	Workers     int     `json:"workers"`
+	DurationSec int     `json:"duration_sec"`
+	TargetQPS   float64 `json:"target_qps,omitempty"`    // > 0 — открытая модель
+	MaxInFlight int     `json:"max_in_flight,omitempty"` // открытая модель: предел одновременных запросов (0 = workers)
+
+	// Stages — профиль нагрузки; если задан, duration_sec — сумма ступеней, workers и target_qps не используются.
+	Stages []StressStageParams `json:"stages,omitempty"`
+	// Queries — смесь шаблонов с весами; если задана, query_name не используется.
+	Queries []StressQueryParams `json:"queries,omitempty"`
+}
+
+// StressQueryParams — шаблон в смеси (как stress_test.queries в конфиге).
+type StressQueryParams struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+}
+
+// StressStageParams — ступень профиля (как stress_test.stages в конфиге).
+type StressStageParams struct {
+	DurationSec int     `json:"duration_sec"`
+	Workers     int     `json:"workers,omitempty"`
+	TargetQPS   float64 `json:"target_qps,omitempty"`
+	Ramp        bool    `json:"ramp,omitempty"`
+}
+
+// StressInfo — состояние стресс-теста для API (GET /api/stress/{id}); его же отдаёт кнопка «Сохранить».
+type StressInfo struct {
+	ID         string                  `json:"id"`
+	Status     string                  `json:"status"` // running, done, cancelled
+	Params     StressParams            `json:"params"`
+	StartedAt  time.Time               `json:"started_at"`
+	FinishedAt *time.Time              `json:"finished_at,omitempty"`
+	Intervals  []runner.StressInterval `json:"intervals"`
+	Result     *runner.StressResult    `json:"result,omitempty"` // сводка и гистограмма задержек после завершения
+}
+
+// StressOverview — ответ GET /api/stress: шаблоны для выбора, значения по умолчанию и текущий тест.
+type StressOverview struct {
+	Templates []string     `json:"templates"`
+	Defaults  StressParams `json:"defaults"`
+	Current   string       `json:"current,omitempty"` // ID выполняющегося стресс-теста
+}
+
+// stressJob — стресс-тест, запущенный через API.
+type stressJob struct {
+	mu         sync.Mutex
+	id         string
+	params     StressParams
+	status     string
+	startedAt  time.Time
+	finishedAt time.Time
+	intervals  []runner.StressInterval
+	result     *runner.StressResult
+	config     report.StressConfig // параметры для отчёта стресс-теста
+	events     *eventLog           // interval раз в секунду, в конце done
+
+	client    chclient.Client
+	tracker   *chclient.QueryTracker
+	cancelRun context.CancelFunc
+	stopped   bool
+	ran       bool          // RunStressWithProgress вернулся: останавливать уже нечего
+	aborted   chan struct{} // закрывается, когда KILL QUERY после остановки выполнен
+	abortErr  error         // ошибка KILL QUERY — в предупреждения отчёта
+}
+
+func (j *stressJob) info() StressInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info := StressInfo{
+		ID:        j.id,
+		Status:    j.status,
+		Params:    j.params,
+		StartedAt: j.startedAt,
+		Intervals: append([]runner.StressInterval{}, j.intervals...),
+		Result:    j.result,
+	}
+	if !j.finishedAt.IsZero() {
+		t := j.finishedAt
+		info.FinishedAt = &t
+	}
+	return info
+}
+
+// reportResult возвращает результат для отчёта (с рядом по секундам) и предупреждения;
+// nil, если тест ещё выполняется.
+func (j *stressJob) reportResult() (report.StressConfig, *runner.StressResult, []string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.result == nil {
+		return j.config, nil, nil
+	}
+	res := *j.result
+	res.Intervals = append([]runner.StressInterval{}, j.intervals...)
+	var warnings []string
+	if j.abortErr != nil {
+		warnings = append(warnings, runner.AbortWarning(j.abortErr))
+	}
+	return j.config, &res, warnings
+}
+
+// stop останавливает стресс-тест досрочно (KILL QUERY по выполняющимся запросам).
+// Возвращает false, если тест уже завершён.
+func (j *stressJob) stop() (bool, error) {
+	j.mu.Lock()
+	if j.status != JobRunning || j.stopped || j.ran {
+		j.mu.Unlock()
+		return false, nil
+	}
+	j.stopped = true
+	j.aborted = make(chan struct{})
+	j.mu.Unlock()
+	err := runner.Abort(j.cancelRun, j.tracker, j.client)
+	j.mu.Lock()
+	j.abortErr = err
+	j.mu.Unlock()
+	close(j.aborted)
+	return true, err
+}
+
+// stressManager — стресс-тесты, запущенные через API. Одновременно выполняется не больше одного:
+// параллельные тесты мешали бы друг другу и перегружали бы кластер.
+type stressManager struct {
+	mu       sync.Mutex
+	jobs     map[string]*stressJob
+	current  *stressJob
+	finished []string // ID завершённых тестов в порядке завершения
+}
+
+func newStressManager() *stressManager {
+	return &stressManager{jobs: make(map[string]*stressJob)}
+}
+
+func (m *stressManager) get(id string) *stressJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.jobs[id]
+}
+
+// running возвращает ID выполняющегося стресс-теста (пусто, если нет).
+func (m *stressManager) running() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.current == nil {
+		return ""
+	}
+	return m.current.id
+}
+
+// stressDefaults — параметры по умолчанию из секции stress_test.
+func stressDefaults(cfg *config.Config) StressParams {
+	p := StressParams{Workers: cfg.Execution.Workers, DurationSec: 60}
+	if st := cfg.StressTest; st != nil {
+		p.QueryName = st.QueryName
+		if st.Workers > 0 {
+			p.Workers = st.Workers
+		}
+		if st.DurationMinutes > 0 {
+			p.DurationSec = st.DurationMinutes * 60
+		}
+		p.TargetQPS = st.TargetQPS
+		p.MaxInFlight = st.MaxInFlight
+		for _, s := range st.Stages {
+			p.Stages = append(p.Stages, StressStageParams{DurationSec: s.DurationSec, Workers: s.Workers, TargetQPS: s.TargetQPS, Ramp: s.Ramp})
+		}
+		if len(p.Stages) > 0 {
+			p.DurationSec = int(st.Duration() / time.Second)
+		}
+		for _, q := range st.Queries {
+			p.Queries = append(p.Queries, StressQueryParams{Name: q.Name, Weight: q.Weight})
+		}
+	}
+	if p.QueryName == "" && len(cfg.QueryTemplates) > 0 {
+		p.QueryName = cfg.QueryTemplates[0].Name
+	}
+	return p
+}
+
+// start проверяет параметры и запускает стресс-тест в фоне на отдельном подключении: пул общего клиента
+// сервера мал для теста, и запросы сверх пула ждали бы соединение вместо нагрузки на сервер.
+func (m *stressManager) start(ctx context.Context, cfg *config.Config, p StressParams, connOpts chclient.ConnectOptions, queryTimeout time.Duration) (*stressJob, error) {
+	def := stressDefaults(cfg)
+	if p.QueryName == "" {
+		p.QueryName = def.QueryName
+	}
+	if p.Workers == 0 {
+		p.Workers = def.Workers
+	}
+	if p.DurationSec == 0 {
+		p.DurationSec = def.DurationSec
+	}
+	if p.Workers < 1 || p.Workers > maxStressWorkers {
+		return nil, fmt.Errorf("workers must be between 1 and %d", maxStressWorkers)
+	}
+	if p.TargetQPS < 0 || p.TargetQPS > maxStressQPS {
+		return nil, fmt.Errorf("target_qps must be between 0 and %d", maxStressQPS)
+	}
+	stages, err := stressStages(p.Stages)
+	if err != nil {
+		return nil, err
+	}
+	open := p.TargetQPS > 0
+	if len(stages) > 0 {
+		// длительность и модель задаёт профиль
+		p.TargetQPS = 0
+		p.DurationSec = 0
+		open = false
+		for _, s := range p.Stages {
+			p.DurationSec += s.DurationSec
+			open = open || s.TargetQPS > 0
+		}
+	}
+	if p.DurationSec < 1 || p.DurationSec > maxStressDurationSec {
+		return nil, fmt.Errorf("duration_sec must be between 1 and %d", maxStressDurationSec)
+	}
+	if !open {
+		p.MaxInFlight = 0
+	} else if p.MaxInFlight == 0 {
+		p.MaxInFlight = p.Workers
+	}
+	if p.MaxInFlight < 0 || p.MaxInFlight > maxStressWorkers {
+		return nil, fmt.Errorf("max_in_flight must be between 1 and %d", maxStressWorkers)
+	}
+	var baseQuery string
+	var queries []runner.StressQuery
+	if len(p.Queries) > 0 {
+		p.QueryName = ""
+		for i, q := range p.Queries {
+			if q.Weight == 0 {
+				p.Queries[i].Weight = 1
+			} else if q.Weight < 0 {
+				return nil, fmt.Errorf("queries[%d]: weight must not be negative", i)
+			}
+			query, err := config.StressQueryByName(cfg, q.Name)
+			if err != nil {
+				return nil, err
+			}
+			queries = append(queries, runner.StressQuery{Name: q.Name, Query: query, Weight: p.Queries[i].Weight})
+		}
+	} else if baseQuery, err = config.StressQueryByName(cfg, p.QueryName); err != nil {
+		return nil, err
+	}
+
+	if m.running() != "" {
+		return nil, errStressRunning
+	}
+	opts := runner.StressOptions{Workers: p.Workers, TargetQPS: p.TargetQPS, MaxInFlight: p.MaxInFlight, QueryTimeout: queryTimeout, Stages: stages, Queries: queries, ServerStats: true}
+	connOpts.MaxOpenConns = opts.Concurrency()
+	client, err := chclient.New(ctx, connOpts)
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.current != nil {
+		_ = client.Close()
+		return nil, errStressRunning
+	}
+	runCtx, cancel := context.WithTimeout(ctx, time.Duration(p.DurationSec)*time.Second)
+	runCtx, tracker := chclient.WithQueryTracker(runCtx)
+	j := &stressJob{
+		id:        newJobID(),
+		params:    p,
+		status:    JobRunning,
+		startedAt: time.Now(),
+		config:    report.NewStressConfig(p.QueryName, opts, time.Duration(p.DurationSec)*time.Second),
+		events:    newEventLog(),
+		client:    client,
+		tracker:   tracker,
+		cancelRun: cancel,
+	}
+	m.jobs[j.id] = j
+	m.current = j
+
+	go func() {
+		defer func() { _ = client.Close() }()
+		defer cancel()
+		res := runner.RunStressWithProgress(runCtx, baseQuery, opts, client, func(iv runner.StressInterval) {
+			j.mu.Lock()
+			j.intervals = append(j.intervals, iv)
+			j.mu.Unlock()
+			j.events.append("interval", iv)
+		})
+		j.mu.Lock()
+		j.ran = true
+		aborted := j.aborted
+		j.mu.Unlock()
+		if aborted != nil {
+			<-aborted // итог публикуется вместе с результатом KILL QUERY
+		}
+		// ряд по секундам отдаётся в StressInfo.Intervals, в итоге его не дублируем
+		summary := *res
+		summary.Intervals = nil
+		j.mu.Lock()
+		j.finishedAt = time.Now()
+		j.intervals = res.Intervals
+		j.result = &summary
+		j.status = JobDone
+		if j.stopped {
+			j.status = JobCancelled
+		}
+		status := j.status
+		j.mu.Unlock()
+
+		m.mu.Lock()
+		m.current = nil
+		m.finished = append(m.finished, j.id)
+		if n := len(m.finished) - maxFinishedStressJobs; n > 0 {
+			for _, id := range m.finished[:n] {
+				delete(m.jobs, id)
+			}
+			m.finished = append([]string(nil), m.finished[n:]...)
+		}
+		m.mu.Unlock()
+		j.events.append(eventDone, struct {
+			Status string               `json:"status"`
+			Result *runner.StressResult `json:"result"`
+		}{status, &summary})
+	}()
+	return j, nil
+}
+
+// stressStages проверяет профиль из API и переводит его в ступени раннера.
+func stressStages(params []StressStageParams) ([]runner.StressStage, error) {
+	cs := make([]config.StressStage, len(params))
+	var stages []runner.StressStage
+	for i, s := range params {
+		if s.Workers > maxStressWorkers || s.TargetQPS > maxStressQPS {
+			return nil, fmt.Errorf("stage %d: workers must be at most %d and target_qps at most %d", i+1, maxStressWorkers, maxStressQPS)
+		}
+		cs[i] = config.StressStage{DurationSec: s.DurationSec, Workers: s.Workers, TargetQPS: s.TargetQPS, Ramp: s.Ramp}
+		stages = append(stages, runner.StressStage{
+			Duration:  time.Duration(s.DurationSec) * time.Second,
+			Workers:   s.Workers,
+			TargetQPS: s.TargetQPS,
+			Ramp:      s.Ramp,
+		})
+	}
+	if err := config.ValidateStressStages(cs); err != nil {
+		return nil, fmt.Errorf("stages: %w", err)
+	}
+	return stages, nil
+}
+
+// errStressRunning — уже выполняется другой стресс-тест.
+var errStressRunning = errors.New("another stress test is running")
@@ -1,6 +1,8 @@
 // Package tests определяет типы тестов и результатов для runner и отчёта.
 package tests
 
+import "clicktester/internal/ddl"
+
 // Task — одна задача для выполнения (структурная проверка или запрос).
 type Task struct {
 	ID          int
@@ -19,10 +21,64 @@ const (
 	TaskTypeQuery     TaskType = "query"
 )
 
-// TaskOpts — опции выполнения (EXPLAIN, сбор статистики).
+// CacheMode — режим замера относительно серверных кэшей.
+type CacheMode string
+
+const (
+	CacheModeWarm CacheMode = "warm" // как есть, кэши не сбрасываются
+	CacheModeCold CacheMode = "cold" // перед каждым замером сбрасываются кэши, use_query_cache = 0
+	CacheModeBoth CacheMode = "both" // холодный замер, затем тёплый; в отчёте оба времени
+)
+
+// Источники TestResult.ProjectionUsed.
+const (
+	ProjectionSourceQueryLog = "query_log" // query_log.projections (collect_stats)
+)
+
+// TaskOpts — опции выполнения (EXPLAIN, сбор статистики, ожидания).
 type TaskOpts struct {
 	CollectExplain bool
 	CollectStats   bool
+	Assertions     Assertions
+	Database       string // таблица структурной проверки
+	Table          string
+	Expect         *StructureSpec // эталон структурной проверки (nil — только выполнить запрос)
+	ReferenceDDL   *ddl.Table     // эталонный CREATE TABLE для ddl_drift
+	MaxResultRows  int            // сколько строк результата структурной проверки сохранять в отчёт
+	Iterations     int            // число замеров запроса (1 — один замер без сводки)
+	Warmup         int            // прогревочных запусков перед замерами (в результат не входят)
+	CacheMode      CacheMode      // пусто или warm — без сброса кэшей
+}
+
+// StructureSpec — эталонная структура таблицы; пустые поля не проверяются.
+type StructureSpec struct {
+	Indexes          []IndexSpec
+	Projections      []string
+	OrderBy          string
+	PrimaryKey       string
+	PartitionBy      string
+	TTL              string
+	IndexGranularity int
+	Codecs           map[string]string // колонка → кодек
+}
+
+// IndexSpec — ожидаемый data skipping индекс.
+type IndexSpec struct {
+	Name        string
+	Type        string
+	Expr        string
+	Granularity int
+}
+
+// Assertions — ожидания для запроса; нулевые значения не проверяются.
+type Assertions struct {
+	MaxGranules      int
+	MaxReadRows      uint64
+	MaxReadBytes     uint64
+	MaxDurationMs    float64
+	MinRowsReturned  int
+	ExpectProjection string // имя ожидаемой проекции или "true" (любая)
+	ExpectIndexUsed  string // имя skip-индекса или стадия (PrimaryKey, MinMax, Partition)
 }
 
 // PartitionInfo — сведения о партиции из system.parts (для отчёта).
@@ -32,32 +88,117 @@ type PartitionInfo struct {
 	Bytes     uint64 `json:"bytes"`
 }
 
+// IndexStage — стадия воронки отсечения из EXPLAIN indexes=1 (для отчёта).
+type IndexStage struct {
+	Table          string `json:"table,omitempty"`      // таблица из ReadFromMergeTree
+	Stage          string `json:"stage"`                // MinMax, Partition, PrimaryKey, Skip
+	Name           string `json:"name,omitempty"`       // имя skip-индекса
+	IndexType      string `json:"index_type,omitempty"` // bloom_filter, tokenbf_v1, ...
+	PartsBefore    int    `json:"parts_before"`
+	PartsAfter     int    `json:"parts_after"`
+	GranulesBefore int    `json:"granules_before"`
+	GranulesAfter  int    `json:"granules_after"`
+}
+
+// MetricSummary — сводка по повторным замерам одной метрики.
+type MetricSummary struct {
+	Min    float64 `json:"min"`
+	Median float64 `json:"median"`
+	P95    float64 `json:"p95"`
+	Max    float64 `json:"max"`
+	Stddev float64 `json:"stddev"`
+}
+
+// Regression — рост метрики относительно baseline-отчёта сверх допустимого порога.
+type Regression struct {
+	Metric   string  `json:"metric"` // granules, read_rows, read_bytes, memory_usage, duration_ms
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+	Delta    float64 `json:"delta"`
+	DeltaPct float64 `json:"delta_pct,omitempty"` // 0, если в baseline метрика была нулевой
+}
+
+// ResultTable — табличный результат запроса (для структурных проверок; строки обрезаны до execution.max_result_rows).
+type ResultTable struct {
+	Columns   []string   `json:"columns"`
+	Types     []string   `json:"types"`
+	Rows      [][]string `json:"rows"`
+	TotalRows int        `json:"total_rows"`
+}
+
 // TestResult — результат выполнения одной задачи (поля с json для экспорта).
 type TestResult struct {
-	TaskID           int              `json:"task_id"`
-	Name             string           `json:"name"`
-	Description      string           `json:"description"`
-	Type             TaskType         `json:"type"`
-	Query            string           `json:"query"`
-	Pass             bool             `json:"pass"`
-	Error            string           `json:"error,omitempty"`
-	Granules         int              `json:"granules"`
-	ReadRows         uint64           `json:"read_rows"`
-	ReadBytes        uint64           `json:"read_bytes"`
-	MemoryUsage      uint64           `json:"memory_usage"`
-	QueryID          string           `json:"query_id,omitempty"`          // для поиска в system.query_log
-	Partitions       []string         `json:"partitions,omitempty"`       // ID партиций из query_log
-	PartitionDetails []PartitionInfo  `json:"partition_details,omitempty"` // строки/байты по партициям из system.parts
-	DurationMs       float64          `json:"duration_ms"`
-	RowsReturned     int              `json:"rows_returned"`
-	ProjectionUsed   bool             `json:"projection_used"`
-	ExplainText      string           `json:"explain_text,omitempty"`
+	TaskID            int               `json:"task_id"`
+	Name              string            `json:"name"`
+	Description       string            `json:"description"`
+	Type              TaskType          `json:"type"`
+	Query             string            `json:"query"`
+	Pass              bool              `json:"pass"`
+	Error             string            `json:"error,omitempty"`
+	Cancelled         bool              `json:"cancelled,omitempty"`          // прогон отменён до завершения задачи
+	AssertionFailures []string          `json:"assertion_failures,omitempty"` // невыполненные ожидания (assertions шаблона, expect структурной проверки)
+	Granules          int               `json:"granules"`
+	ReadRows          uint64            `json:"read_rows"`
+	ReadBytes         uint64            `json:"read_bytes"`
+	MemoryUsage       uint64            `json:"memory_usage"`
+	ServerDurationMs  uint64            `json:"server_duration_ms,omitempty"` // query_duration_ms из query_log
+	ProfileEvents     map[string]uint64 `json:"profile_events,omitempty"`     // выбранные ProfileEvents (execution.profile_events)
+	QueryID           string            `json:"query_id,omitempty"`           // для поиска в system.query_log
+	Partitions        []string          `json:"partitions,omitempty"`         // ID партиций из query_log
+	PartitionDetails  []PartitionInfo   `json:"partition_details,omitempty"`  // строки/байты по партициям из system.parts
+	DurationMs        float64           `json:"duration_ms"`
+	RowsReturned      int               `json:"rows_returned"`
+	ProjectionUsed    bool              `json:"projection_used"`
+	ProjectionSource  string            `json:"projection_source,omitempty"` // откуда ProjectionUsed (ProjectionSource*); пусто — неизвестно
+	Projections       []string          `json:"projections,omitempty"`       // проекции из query_log.projections
+	ExplainText       string            `json:"explain_text,omitempty"`
+	IndexFunnel       []IndexStage      `json:"index_funnel,omitempty"` // воронка отсечения по стадиям EXPLAIN indexes=1
+	ResultTable       *ResultTable      `json:"result_table,omitempty"` // строки результата структурной проверки
+	// При iterations > 1 DurationMs, ReadRows и MemoryUsage — медианы замеров, ниже — полная сводка.
+	Iterations    int            `json:"iterations,omitempty"`
+	Warmup        int            `json:"warmup,omitempty"`
+	DurationStats *MetricSummary `json:"duration_stats,omitempty"`
+	ReadRowsStats *MetricSummary `json:"read_rows_stats,omitempty"`
+	MemoryStats   *MetricSummary `json:"memory_stats,omitempty"`
+	// Режим cold/both: время после сброса кэшей и (для both) повторного запуска на прогретых кэшах.
+	CacheMode         CacheMode      `json:"cache_mode,omitempty"`
+	ColdDurationMs    float64        `json:"cold_duration_ms,omitempty"`
+	WarmDurationMs    float64        `json:"warm_duration_ms,omitempty"`
+	ColdDurationStats *MetricSummary `json:"cold_duration_stats,omitempty"`
+	CacheWarnings     []string       `json:"cache_warnings,omitempty"` // кэши, которые не удалось сбросить
+	Regressions       []Regression   `json:"regressions,omitempty"`    // регрессии относительно -baseline
 }
 
 // RunResult — агрегированный результат прогона всех тестов.
 type RunResult struct {
-	Total   int
-	Passed  int
-	Failed  int
-	Results []TestResult
+	Total     int
+	Passed    int
+	Failed    int
+	Cancelled int // не выполнены из-за отмены прогона (в Failed не входят)
+	Results   []TestResult
+}
+
+// ComparisonResult — результат A/B-сравнения: одни и те же шаблоны на таблицах A и B.
+type ComparisonResult struct {
+	TableA string           `json:"table_a"`
+	TableB string           `json:"table_b"`
+	WinsA  int              `json:"wins_a"`
+	WinsB  int              `json:"wins_b"`
+	Ties   int              `json:"ties"`
+	Pairs  []ComparisonPair `json:"pairs"`
+}
+
+// ComparisonPair — результаты одного шаблона на обеих таблицах.
+type ComparisonPair struct {
+	Name   string     `json:"name"`
+	A      TestResult `json:"a"`
+	B      TestResult `json:"b"`
+	Winner string     `json:"winner"` // a, b, tie; пусто — запрос упал на обеих таблицах
+	// SpeedUp — во сколько раз B быстрее A по длительности (>1 — B быстрее); 0, если не с чем сравнить.
+	SpeedUp float64 `json:"speed_up,omitempty"`
+	// *ReductionPct — на сколько процентов B читает меньше A (отрицательное — больше).
+	GranulesReductionPct  float64 `json:"granules_reduction_pct"`
+	ReadRowsReductionPct  float64 `json:"read_rows_reduction_pct"`
+	ReadBytesReductionPct float64 `json:"read_bytes_reduction_pct"`
+	MemoryReductionPct    float64 `json:"memory_reduction_pct"`
 }